@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+const aliasUsage = `Usage: az-wrap alias <command> [arguments]
+
+Commands:
+  ls [-origin]                List all aliases, optionally with the file they come from
+  check                       Audit aliases for unknown subscriptions and ambiguous names
+  set <subscription> <alias>  Set or replace the primary alias of a subscription
+  add <subscription> <alias>  Add an additional alias to a subscription
+  rm <alias|id>               Remove an alias, or all aliases of a subscription ID
+  mv <old> <new>              Rename an alias
+  edit <subscription>         Edit metadata with -tags, -note, -owner and -color
+  export                      Export aliases with -format json|csv|md and -o <file>
+  import <file>               Import aliases from json or csv with -mode merge|replace
+                              and -dry-run
+  tenant <command>            Manage tenant aliases, see 'az-wrap alias tenant'
+  suggest                     Suggest aliases for unaliased subscriptions from the rules
+                              file, use -apply to save them
+
+<subscription> can be a subscription ID, name, index or alias. New aliases are
+validated against your subscriptions, use -force to skip the checks.`
+
+// runAliasCommand handles the "alias" subcommand.
+func runAliasCommand(cfg *config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(aliasUsage)
+	}
+
+	fs := flag.NewFlagSet("alias "+args[0], flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), aliasUsage) }
+	tags := fs.String("tags", "", "Comma separated tags, use an empty value to clear")
+	note := fs.String("note", "", "Free text note")
+	owner := fs.String("owner", "", "Owner of the subscription")
+	colorName := fs.String("color", "", "Color of the alias: "+strings.Join(colorNames(), ", "))
+	origin := fs.Bool("origin", false, "Show which alias source each alias comes from")
+	format := fs.String("format", "", "Import or export format: json, csv or md")
+	output := fs.String("o", "", "Write the export to a file instead of stdout")
+	mode := fs.String("mode", "merge", "Import mode: merge or replace")
+	dryRun := fs.Bool("dry-run", false, "Only report what an import would change")
+	force := fs.Bool("force", false, "Skip alias validation")
+	rules := fs.String("rules", filepath.Join(cfg.stateDir, "rules.json"), "Rules file used by suggest")
+	apply := fs.Bool("apply", false, "Save the suggested aliases")
+	rest := parseArgs(fs, args[1:])
+
+	switch args[0] {
+	case "ls", "list":
+		return listAliases(cfg, *origin)
+	case "check":
+		return runAliasCheck(cfg)
+	case "set", "add":
+		if len(rest) != 2 {
+			return fmt.Errorf("usage: az-wrap alias %s <subscription> <alias> [-force]", args[0])
+		}
+		id, err := prepareAlias(cfg, rest[0], rest[1], *force)
+		if err != nil {
+			return err
+		}
+		if args[0] == "add" {
+			return cfg.addAlias(id, rest[1])
+		}
+		return cfg.saveAliasFile(id, rest[1])
+	case "rm", "remove":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: az-wrap alias rm <alias|id>")
+		}
+		id, removed, err := cfg.removeAlias(rest[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Alias '%s' removed from subscription ID '%s'.\n", strings.Join(removed, "', '"), id)
+		return nil
+	case "mv", "rename":
+		if len(rest) != 2 {
+			return fmt.Errorf("usage: az-wrap alias mv <old> <new> [-force]")
+		}
+		store, err := cfg.loadMergedAliasStore()
+		if err != nil {
+			return err
+		}
+		if owner, ok := store.lookup(rest[0]); ok {
+			if _, err := prepareAlias(cfg, owner, rest[1], *force); err != nil {
+				return err
+			}
+		}
+		id, err := cfg.renameAlias(rest[0], rest[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Alias '%s' renamed to '%s' for subscription ID '%s'.\n", rest[0], rest[1], id)
+		return nil
+	case "edit":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: az-wrap alias edit <subscription> [-tags a,b] [-note text] [-owner name] [-color name]")
+		}
+		id, err := resolveSubscriptionID(cfg, rest[0])
+		if err != nil {
+			return err
+		}
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		return cfg.editSubscriptionMeta(id, func(m *subscriptionMeta) error {
+			if set["tags"] {
+				m.Tags = splitList(*tags)
+			}
+			if set["note"] {
+				m.Note = *note
+			}
+			if set["owner"] {
+				m.Owner = *owner
+			}
+			if set["color"] {
+				if _, ok := aliasColors[*colorName]; !ok && *colorName != "" {
+					return fmt.Errorf("unknown color '%s', use one of: %s", *colorName, strings.Join(colorNames(), ", "))
+				}
+				m.Color = *colorName
+			}
+			return nil
+		})
+	case "export":
+		if len(rest) != 0 {
+			return fmt.Errorf("usage: az-wrap alias export [-format json|csv|md] [-o file]")
+		}
+		if *format == "" {
+			*format = "json"
+		}
+		return runAliasExport(cfg, *format, *output)
+	case "import":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: az-wrap alias import <file> [-format json|csv] [-mode merge|replace] [-dry-run] [-force]")
+		}
+		if *mode != "merge" && *mode != "replace" {
+			return fmt.Errorf("unknown import mode '%s', use merge or replace", *mode)
+		}
+		return runAliasImport(cfg, rest[0], *format, *mode == "replace", *dryRun, *force)
+	case "tenant":
+		return runTenantAliasCommand(cfg, rest, *force)
+	case "suggest":
+		return runAliasSuggest(cfg, *rules, *apply, *force)
+	default:
+		return fmt.Errorf("unknown alias command '%s'\n\n%s", args[0], aliasUsage)
+	}
+}
+
+// listAliases prints every subscription in the merged alias stores together
+// with its name and metadata.
+func listAliases(cfg *config, showOrigin bool) error {
+	store, err := cfg.loadMergedAliasStore()
+	if err != nil {
+		return err
+	}
+	if len(store.Subscriptions) == 0 {
+		fmt.Println("No aliases set")
+		return nil
+	}
+
+	names := make(map[string]string)
+	if subs, err := cfg.subscriptions(); err == nil {
+		for _, s := range subs {
+			names[s.ID] = s.Name
+		}
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	headers := []interface{}{"Alias", "Name", "ID", "Tags", "Owner", "Note"}
+	if showOrigin {
+		headers = append(headers, "Origin")
+	}
+
+	tbl := table.New(headers...)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, id := range store.ids() {
+		m := store.Subscriptions[id]
+		name, ok := names[id]
+		if !ok {
+			name = "(unknown subscription)"
+		}
+		row := []interface{}{strings.Join(m.Aliases, ", "), name, id, strings.Join(m.Tags, ", "), m.Owner, m.Note}
+		if showOrigin {
+			origin := ""
+			if m.origin.Name != "" {
+				origin = m.origin.String()
+			}
+			row = append(row, origin)
+		}
+		tbl.AddRow(row...)
+	}
+	tbl.Print()
+	return nil
+}
+
+func runAliasExport(cfg *config, format, output string) error {
+	store, err := cfg.loadMergedAliasStore()
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]string)
+	if format != "json" {
+		if subs, err := cfg.subscriptions(); err == nil {
+			for _, s := range subs {
+				names[s.ID] = s.Name
+			}
+		}
+	}
+
+	if output == "" {
+		return exportAliases(os.Stdout, store, names, format)
+	}
+	var buf bytes.Buffer
+	if err := exportAliases(&buf, store, names, format); err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to write export: %w", err)
+	}
+	fmt.Printf("Exported %d subscriptions to %s.\n", len(store.Subscriptions), output)
+	return nil
+}
+
+func runAliasImport(cfg *config, file, format string, replace, dryRun, force bool) error {
+	incoming, err := readAliasImport(file, format)
+	if err != nil {
+		return err
+	}
+	current, err := cfg.loadAliasStore()
+	if err != nil {
+		return err
+	}
+
+	result, changes := planImport(current, incoming, replace)
+	invalid := 0
+	if !force {
+		subs, err := cfg.subscriptionAliases()
+		if err != nil {
+			return fmt.Errorf("unable to validate the imported aliases, use -force to skip validation: %w", err)
+		}
+		// Imported aliases must not clash with the shared ones either.
+		view, err := cfg.loadSharedAliasStores()
+		if err != nil {
+			return err
+		}
+		view.merge(result, aliasSource{Name: userAliasSource, Path: cfg.storeFile})
+		invalid = validateImport(subs, view, changes)
+	}
+
+	conflictFmt := color.New(color.FgYellow).SprintFunc()
+	problemFmt := color.New(color.FgRed).SprintFunc()
+	conflicts := 0
+	for _, ch := range changes {
+		fmt.Printf("%-9s %s\n", ch.Action, ch.ID)
+		for _, conflict := range ch.Conflicts {
+			fmt.Printf("          %s %s\n", conflictFmt("conflict:"), conflict)
+		}
+		for _, problem := range ch.Problems {
+			fmt.Printf("          %s %s\n", problemFmt("invalid:"), problem)
+		}
+		if len(ch.Conflicts) > 0 {
+			conflicts++
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("Dry run: %d subscriptions, %d with conflicts, %d invalid aliases. Nothing was written.\n", len(changes), conflicts, invalid)
+		return nil
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d imported aliases are invalid, use -force to import them anyway", invalid)
+	}
+	if err := cfg.saveAliasStore(result); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d subscriptions, %d with conflicts resolved in favor of %s.\n", len(changes), conflicts, file)
+	return nil
+}
+
+// editSubscriptionMeta applies edit to the stored metadata of a subscription.
+func (c *config) editSubscriptionMeta(subscriptionId string, edit func(m *subscriptionMeta) error) error {
+	store, err := c.loadAliasStore()
+	if err != nil {
+		return err
+	}
+	if err := edit(store.meta(subscriptionId)); err != nil {
+		return err
+	}
+	if err := c.saveAliasStore(store); err != nil {
+		return fmt.Errorf("error writing to alias file: %w", err)
+	}
+	fmt.Printf("Updated subscription ID '%s'.\n", subscriptionId)
+	return nil
+}
+
+// resolveSubscriptionID turns a subscription ID, name or index into a
+// subscription ID. Unknown values are passed through as raw IDs.
+func resolveSubscriptionID(cfg *config, query string) (string, error) {
+	aliases, err := cfg.subscriptionAliases()
+	if err != nil {
+		return query, nil
+	}
+	return resolveIn(aliases, query), nil
+}
+
+func resolveIn(aliases []subscriptionAlias, query string) string {
+	if s, ok := findSubscription(aliases, query); ok {
+		return s.ID
+	}
+	return query
+}
+
+// prepareAlias resolves the subscription a new alias is meant for and
+// validates the alias against the loaded subscriptions unless force is set.
+func prepareAlias(cfg *config, query, alias string, force bool) (string, error) {
+	aliases, err := cfg.subscriptionAliases()
+	if err != nil {
+		if force {
+			return query, nil
+		}
+		return "", fmt.Errorf("unable to validate alias, use -force to skip validation: %w", err)
+	}
+
+	id := resolveIn(aliases, query)
+	if force {
+		return id, nil
+	}
+	store, err := cfg.loadMergedAliasStore()
+	if err != nil {
+		return "", err
+	}
+	return id, validateAlias(aliases, store, id, alias)
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,10 +1,10 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -16,17 +16,53 @@ import (
 )
 
 type loadedSubscriptions struct {
-	Name     string `json:"name"`
-	ID       string `json:"id"`
-	Selected bool   `json:"isDefault"`
+	Name             string            `json:"name"`
+	ID               string            `json:"id"`
+	Selected         bool              `json:"isDefault"`
+	TenantID         string            `json:"tenantId"`
+	HomeTenantID     string            `json:"homeTenantId"`
+	State            string            `json:"state"`
+	User             subscriptionUser  `json:"user"`
+	EnvironmentName  string            `json:"environmentName"`
+	CloudName        string            `json:"cloudName"`
+	ManagedByTenants []managedByTenant `json:"managedByTenants"`
+}
+
+type subscriptionUser struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type managedByTenant struct {
+	TenantID string `json:"tenantId"`
 }
 
 type subscriptionAlias struct {
-	Name     string
-	ID       string
-	Index    int
-	Alias    string
-	Selected bool
+	Name             string
+	ID               string
+	Index            int
+	Alias            string
+	Aliases          []string
+	Tags             []string
+	Note             string
+	Owner            string
+	Color            string
+	Pinned           bool
+	Selected         bool
+	TenantID         string
+	TenantAlias      string
+	HomeTenantID     string
+	State            string
+	User             string
+	UserType         string
+	Cloud            string
+	ManagedByTenants []string
+}
+
+// delegated reports whether the subscription is accessed through Azure
+// Lighthouse, i.e. from a tenant other than its home tenant.
+func (s subscriptionAlias) delegated() bool {
+	return s.HomeTenantID != "" && s.TenantID != "" && !strings.EqualFold(s.TenantID, s.HomeTenantID)
 }
 
 type config struct {
@@ -34,6 +70,27 @@ type config struct {
 	azureDir     string
 	aliasFile    string
 	azureProfile string
+	stateDir     string
+	storeFile    string
+	profilesFile string
+	// profile is the name of the az profile in use, empty for the config
+	// directory the Azure CLI would use.
+	profile string
+	// sources are the names of the subscription sources in the order they
+	// are tried, see subscriptionSources.
+	sources []string
+	// armEndpoint overrides the Resource Manager endpoint of the active cloud.
+	armEndpoint string
+	// cacheTTL is how long cached CLI results count as fresh, refresh
+	// bypasses the cache. cachedAt and cacheStale describe the cached result
+	// that was served, if any.
+	cacheTTL   time.Duration
+	refresh    bool
+	cachedAt   time.Time
+	cacheStale bool
+	// sharedStoreFiles are read-only alias stores merged below storeFile,
+	// from lowest to highest precedence.
+	sharedStoreFiles []aliasSource
 }
 
 func newConfig() (*config, error) {
@@ -42,12 +99,27 @@ func newConfig() (*config, error) {
 		return nil, fmt.Errorf("unable to find home directory: %w", err)
 	}
 
-	azureDir := filepath.Join(homeDir, ".azure")
+	// az-wrap keeps its own files out of the Azure config directory.
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		userConfigDir = filepath.Join(homeDir, ".config")
+	}
+
+	azureDir := azureConfigDir(homeDir)
+	stateDir := filepath.Join(userConfigDir, "az-wrap")
 	return &config{
 		homeDir:      homeDir,
 		azureDir:     azureDir,
 		azureProfile: filepath.Join(azureDir, "azureProfile.json"),
-		aliasFile:    filepath.Join(azureDir, "aliases"),
+		aliasFile:    filepath.Join(homeDir, ".azure", "aliases"),
+		stateDir:     stateDir,
+		storeFile:    filepath.Join(stateDir, "aliases.json"),
+		profilesFile: filepath.Join(stateDir, "profiles.json"),
+		sources:      sourcesFromEnv(),
+		armEndpoint:  os.Getenv("AZ_WRAP_ARM_ENDPOINT"),
+		cacheTTL:     cacheTTLFromEnv(),
+
+		sharedStoreFiles: sharedAliasSources(),
 	}, nil
 }
 
@@ -57,39 +129,92 @@ func (c *config) subscriptionAliases() ([]subscriptionAlias, error) {
 	if err != nil {
 		return nil, err
 	}
-	aliases, err := c.aliases()
+	store, err := c.loadMergedAliasStore()
 	if err != nil {
 		return nil, err
 	}
 
 	var subscriptionAliases []subscriptionAlias
 	for i, sub := range subs {
-		alias := aliases[sub.ID]
+		meta := store.Subscriptions[sub.ID]
+		if meta == nil {
+			meta = &subscriptionMeta{}
+		}
+		alias := meta.primary()
 		if alias == "" {
 			alias = "(no alias)"
 		}
+		// azureProfile.json calls it environmentName, az account list cloudName.
+		cloud := sub.EnvironmentName
+		if cloud == "" {
+			cloud = sub.CloudName
+		}
+		var managedBy []string
+		for _, t := range sub.ManagedByTenants {
+			managedBy = append(managedBy, t.TenantID)
+		}
 		subscriptionAliases = append(subscriptionAliases, subscriptionAlias{
-			Name:     sub.Name,
-			ID:       sub.ID,
-			Index:    i + 1,
-			Alias:    alias,
-			Selected: sub.Selected,
+			Name:             sub.Name,
+			ID:               sub.ID,
+			Index:            i + 1,
+			Alias:            alias,
+			Aliases:          meta.Aliases,
+			Tags:             meta.Tags,
+			Note:             meta.Note,
+			Owner:            meta.Owner,
+			Color:            meta.Color,
+			Pinned:           meta.Pinned,
+			Selected:         sub.Selected,
+			TenantID:         sub.TenantID,
+			TenantAlias:      store.primaryTenantAlias(sub.TenantID),
+			HomeTenantID:     sub.HomeTenantID,
+			State:            sub.State,
+			User:             sub.User.Name,
+			UserType:         sub.User.Type,
+			Cloud:            cloud,
+			ManagedByTenants: managedBy,
 		})
 	}
 	return subscriptionAliases, nil
 }
 
-// setSubscription sets the Azure subscription using a given ID.
-func (c *config) setSubscription(ctx context.Context, ID string) error {
-	path, err := c.azureCLIPath()
-	if err != nil {
-		return fmt.Errorf("unable to use the Azure CLI for setting subscription: %w", err)
+// setSubscription sets the Azure subscription using a given ID, switching the
+// Azure CLI to the subscription's cloud first when needed. An empty cloud
+// keeps the active one. azureProfile.json is updated directly when possible,
+// which avoids the startup time of the Azure CLI. Set AZ_WRAP_SWITCH=cli to
+// always use the CLI. Every switch is recorded in the history.
+func (c *config) setSubscription(ctx context.Context, ID, cloud string) error {
+	previous := c.defaultSubscriptionID()
+	if err := c.switchSubscription(ctx, ID, cloud); err != nil {
+		return err
+	}
+	c.recordSwitch(ID, previous)
+	return nil
+}
+
+func (c *config) switchSubscription(ctx context.Context, ID, cloud string) error {
+	if cloud != "" && !sameCloud(cloud, c.activeCloud()) {
+		// The Azure CLI keeps a default subscription per cloud, so only it
+		// can switch clouds.
+		if err := c.setCloud(ctx, cloud); err != nil {
+			return err
+		}
+	} else if os.Getenv("AZ_WRAP_SWITCH") != "cli" {
+		// Only a profile az-wrap does not understand is left to the Azure
+		// CLI, any other failure is reported.
+		err := c.setSubscriptionInProfile(ID)
+		if !errors.Is(err, errUnfamiliarProfile) {
+			return err
+		}
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, path, "account", "set", "--subscription", ID)
+	cmd, err := c.azureCommand(ctx, "account", "set", "--subscription", ID)
+	if err != nil {
+		return fmt.Errorf("unable to use the Azure CLI for setting subscription: %w", err)
+	}
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("unable to set subscription: %w", err)
 	}
@@ -97,14 +222,15 @@ func (c *config) setSubscription(ctx context.Context, ID string) error {
 	return nil
 }
 
-// subscriptions retrieves the list of subscriptions.
+// subscriptions retrieves the list of subscriptions from the first
+// subscription source that succeeds.
 func (c *config) subscriptions() ([]loadedSubscriptions, error) {
-	// Prefer file over Azure CLI. It loads ~ 90% quicker.
-	subs, err := c.getSubscriptionsFromFile()
+	sources, err := c.subscriptionSources()
 	if err != nil {
-		subs, err = c.getSubscriptionsWithCLI(context.Background())
+		return nil, err
 	}
 
+	subs, err := loadFromSources(context.Background(), sources)
 	if err != nil {
 		return nil, err
 	}
@@ -143,15 +269,13 @@ func (c *config) getSubscriptionsFromFile() ([]loadedSubscriptions, error) {
 
 // getSubscriptionsWithCLI retrieves subscriptions using the Azure CLI.
 func (c *config) getSubscriptionsWithCLI(ctx context.Context) ([]loadedSubscriptions, error) {
-	path, err := c.azureCLIPath()
-	if err != nil {
-		return nil, fmt.Errorf("unable to use the Azure CLI for getting subscriptions: %w", err)
-	}
-
 	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, path, "account", "list")
+	cmd, err := c.azureCommand(ctx, "account", "list")
+	if err != nil {
+		return nil, fmt.Errorf("unable to use the Azure CLI for getting subscriptions: %w", err)
+	}
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("command could not run: %w", err)
@@ -162,16 +286,26 @@ func (c *config) getSubscriptionsWithCLI(ctx context.Context) ([]loadedSubscript
 		return nil, fmt.Errorf("there was an error unmarshalling Azure CLI accounts: %w", err)
 	}
 
-	// This is an actual error where we want to quit
-	loginErr := color.New(color.FgYellow)
+	// This is an actual error where we want to quit, see exitIfNotLoggedIn.
 	if len(subscriptions) == 0 {
-		loginErr.Println("Unable to fetch any of your subscriptions with Azure CLI. Please login using 'az login'")
-		os.Exit(0)
+		return nil, errNotLoggedIn
 	}
 
 	return subscriptions, err
 }
 
+// errNotLoggedIn is returned when the Azure CLI works but reports no subscriptions.
+var errNotLoggedIn = errors.New("unable to fetch any of your subscriptions with Azure CLI")
+
+// exitIfNotLoggedIn asks the user to log in and exits when err means that
+// the Azure CLI has no subscriptions.
+func exitIfNotLoggedIn(err error) {
+	if errors.Is(err, errNotLoggedIn) {
+		color.New(color.FgYellow).Println("Unable to fetch any of your subscriptions with Azure CLI. Please login using 'az login'")
+		os.Exit(0)
+	}
+}
+
 func (c *config) azureCLIPath() (string, error) {
 	path, err := exec.LookPath("az")
 	if err != nil {
@@ -180,73 +314,148 @@ func (c *config) azureCLIPath() (string, error) {
 	return path, nil
 }
 
+// azureCommand prepares an Azure CLI command running against the active
+// Azure config directory.
+func (c *config) azureCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	path, err := c.azureCLIPath()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(os.Environ(), "AZURE_CONFIG_DIR="+c.azureDir)
+	return cmd, nil
+}
+
+// saveAliasFile sets the primary alias of a subscription, replacing any
+// existing primary alias. Additional aliases are kept.
 func (c *config) saveAliasFile(subscriptionId, alias string) error {
-	aliasFile, err := c.checkAliasFile()
+	store, merged, err := c.loadAliasStores()
 	if err != nil {
-		if err := c.createAliasFile(aliasFile); err != nil {
-			return fmt.Errorf("error creating alias file: %w", err)
-		}
+		return err
+	}
+
+	m := store.editableMeta(merged, subscriptionId)
+	// An additional alias moves up to replace the primary one. Setting the
+	// primary alias again keeps the others.
+	if i := m.aliasIndex(alias); i > 0 {
+		m.Aliases = append(m.Aliases[:i], m.Aliases[i+1:]...)
+	}
+	if len(m.Aliases) == 0 {
+		m.Aliases = []string{alias}
+	} else {
+		m.Aliases[0] = alias
 	}
 
-	if err := c.writeAliasToFile(aliasFile, subscriptionId, alias); err != nil {
+	if err := c.saveAliasStore(store); err != nil {
 		return fmt.Errorf("error writing to alias file: %w", err)
 	}
 
-	fmt.Printf("Alias '%s' added for subscription ID '%s'.\n", alias, subscriptionId)
+	fmt.Printf("Alias '%s' set for subscription ID '%s'.\n", alias, subscriptionId)
 	return nil
 }
 
-func (c *config) writeAliasToFile(aliasFile, subscriptionId, alias string) error {
-	f, err := os.OpenFile(aliasFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// addAlias adds an additional alias to a subscription.
+func (c *config) addAlias(subscriptionId, alias string) error {
+	store, merged, err := c.loadAliasStores()
 	if err != nil {
-		return fmt.Errorf("error opening alias file: %w", err)
+		return err
+	}
+
+	m := store.editableMeta(merged, subscriptionId)
+	if m.hasAlias(alias) {
+		return fmt.Errorf("subscription ID '%s' already has alias '%s'", subscriptionId, alias)
 	}
-	defer f.Close()
+	m.Aliases = append(m.Aliases, alias)
 
-	if _, err := f.WriteString(subscriptionId + ":" + alias + "\n"); err != nil {
+	if err := c.saveAliasStore(store); err != nil {
 		return fmt.Errorf("error writing to alias file: %w", err)
 	}
+
+	fmt.Printf("Alias '%s' added for subscription ID '%s'.\n", alias, subscriptionId)
 	return nil
 }
 
-// aliases loads aliases from the alias file.
-func (c *config) aliases() (map[string]string, error) {
-	aliases := make(map[string]string)
-	file, err := c.checkAliasFile()
+// removeAlias removes a single alias, or every alias of a subscription when
+// key is a subscription ID. It returns the subscription ID and the removed
+// aliases.
+func (c *config) removeAlias(key string) (string, []string, error) {
+	store, merged, err := c.loadAliasStores()
 	if err != nil {
-		return aliases, nil // No aliases file is not a hard error.
+		return "", nil, err
 	}
 
-	f, err := os.Open(file)
-	if err != nil {
-		return aliases, fmt.Errorf("error opening alias file: %w", err)
+	var id string
+	var removed []string
+	if m, ok := merged.Subscriptions[key]; ok && len(m.Aliases) > 0 {
+		id, removed = key, m.Aliases
+	} else if owner, ok := merged.lookup(key); ok {
+		m := merged.Subscriptions[owner]
+		id, removed = owner, []string{m.Aliases[m.aliasIndex(key)]}
+	} else {
+		return "", nil, fmt.Errorf("alias or subscription ID '%s' not found", key)
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, ":")
-		if len(parts) == 2 {
-			aliases[parts[0]] = parts[1]
-		}
+	// An empty alias list in the user store does not hide aliases from the
+	// shared stores, so those can only be removed at their origin.
+	m := store.editableMeta(merged, id)
+	for _, alias := range removed {
+		i := m.aliasIndex(alias)
+		m.Aliases = append(m.Aliases[:i], m.Aliases[i+1:]...)
+	}
+	if origin := merged.Subscriptions[id].origin; len(m.Aliases) == 0 && origin.Name != userAliasSource {
+		return "", nil, fmt.Errorf("the aliases of subscription ID '%s' are defined in the %s alias file %s and can only be removed there", id, origin.Name, origin.Path)
 	}
-	return aliases, scanner.Err()
+
+	if err := c.saveAliasStore(store); err != nil {
+		return "", nil, fmt.Errorf("error writing to alias file: %w", err)
+	}
+	return id, removed, nil
 }
 
-func (c *config) checkAliasFile() (string, error) {
-	aliasPath := filepath.Join(c.homeDir, ".azure", "aliases")
-	if _, err := os.Stat(aliasPath); os.IsNotExist(err) {
-		return aliasPath, err
+// renameAlias renames an existing alias while keeping its subscription and
+// position. It returns the subscription ID.
+func (c *config) renameAlias(oldAlias, newAlias string) (string, error) {
+	store, merged, err := c.loadAliasStores()
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := merged.lookup(oldAlias)
+	if !ok {
+		return "", fmt.Errorf("alias '%s' not found", oldAlias)
+	}
+	if owner, ok := merged.lookup(newAlias); ok && !strings.EqualFold(oldAlias, newAlias) {
+		return "", fmt.Errorf("alias '%s' is already used by subscription ID '%s'", newAlias, owner)
+	}
+
+	m := store.editableMeta(merged, id)
+	m.Aliases[m.aliasIndex(oldAlias)] = newAlias
+
+	if err := c.saveAliasStore(store); err != nil {
+		return "", fmt.Errorf("error writing to alias file: %w", err)
 	}
-	return aliasPath, nil
+	return id, nil
 }
 
-func (c *config) createAliasFile(file string) error {
-	f, err := os.Create(file)
+// aliases returns the primary alias of every subscription in the merged alias stores.
+func (c *config) aliases() (map[string]string, error) {
+	aliases := make(map[string]string)
+	store, err := c.loadMergedAliasStore()
 	if err != nil {
-		return fmt.Errorf("error creating alias file: %w", err)
+		return aliases, err
 	}
-	defer f.Close()
-	return nil
+	for id, m := range store.Subscriptions {
+		if a := m.primary(); a != "" {
+			aliases[id] = a
+		}
+	}
+	return aliases, nil
+}
+
+// checkAliasFile returns the path of the legacy alias file and whether it exists.
+func (c *config) checkAliasFile() (string, error) {
+	if _, err := os.Stat(c.aliasFile); os.IsNotExist(err) {
+		return c.aliasFile, err
+	}
+	return c.aliasFile, nil
 }
@@ -15,39 +15,18 @@ func TestNewConfig(t *testing.T) {
 	}
 }
 
-func TestCreateAliasFile(t *testing.T) {
-	c, err := newConfig()
-	if err != nil {
-		t.Fatalf("Failed to create new config: %v", err)
-	}
-
-	// Use a temporary file for testing
-	tempDir := t.TempDir()
-	c.homeDir = tempDir
-	aliasFile := filepath.Join(tempDir, ".azure", "aliases")
-	os.MkdirAll(filepath.Dir(aliasFile), 0755)
-
-	err = c.createAliasFile(aliasFile)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if _, err := os.Stat(aliasFile); os.IsNotExist(err) {
-		t.Fatalf("Alias file was not created: %v", err)
-	}
-}
-
 func TestSaveAliasFile(t *testing.T) {
 	c, err := newConfig()
 	if err != nil {
 		t.Fatalf("Failed to create new config: %v", err)
 	}
 
-	// Use a temporary file for testing
+	// Use a temporary directory for testing
 	tempDir := t.TempDir()
 	c.homeDir = tempDir
-	aliasFile := filepath.Join(tempDir, ".azure", "aliases")
-	os.MkdirAll(filepath.Dir(aliasFile), 0755)
+	c.aliasFile = filepath.Join(tempDir, ".azure", "aliases")
+	c.stateDir = tempDir
+	c.storeFile = filepath.Join(tempDir, "aliases.json")
 
 	subscriptionId := "test-subscription-id"
 	alias := "test-alias"
@@ -58,14 +37,20 @@ func TestSaveAliasFile(t *testing.T) {
 	}
 
 	// Check that the alias was written correctly
-	content, err := os.ReadFile(aliasFile)
+	content, err := os.ReadFile(c.storeFile)
 	if err != nil {
-		t.Fatalf("Failed to read alias file: %v", err)
+		t.Fatalf("Failed to read alias store: %v", err)
 	}
 
-	expectedContent := subscriptionId + ":" + alias + "\n"
-	if string(content) != expectedContent {
-		t.Fatalf("Alias file content mismatch. Got: %s, Expected: %s", string(content), expectedContent)
+	store, err := parseAliasStore(content)
+	if err != nil {
+		t.Fatalf("Failed to parse alias store: %v", err)
+	}
+	if store.Version != aliasStoreVersion {
+		t.Fatalf("Alias store version mismatch. Got: %d, Expected: %d", store.Version, aliasStoreVersion)
+	}
+	if got := store.Subscriptions[subscriptionId].primary(); got != alias {
+		t.Fatalf("Alias store content mismatch. Got: %s, Expected: %s", got, alias)
 	}
 }
 
@@ -79,7 +64,7 @@ func TestSetSubscription(t *testing.T) {
 	defer cancel()
 
 	subscriptionID := "1234abcd-efgh-4321-1234-ijkl567812"
-	err = c.setSubscription(ctx, subscriptionID)
+	err = c.setSubscription(ctx, subscriptionID, "")
 	if err == nil {
 		t.Fatalf("Expected error when setting subscription with dummy ID, got none")
 	}
@@ -93,6 +78,7 @@ func TestGetSubscriptionsFromFile(t *testing.T) {
 
 	tempDir := t.TempDir()
 	c.homeDir = tempDir
+	c.aliasFile = filepath.Join(tempDir, ".azure", "aliases")
 	c.azureProfile = filepath.Join(tempDir, ".azure", "azureProfile.json")
 
 	// Simple json.. For now no need for struct marhsalling..
@@ -130,6 +116,9 @@ func TestAliases(t *testing.T) {
 
 	tempDir := t.TempDir()
 	c.homeDir = tempDir
+	c.aliasFile = filepath.Join(tempDir, ".azure", "aliases")
+	c.stateDir = tempDir
+	c.storeFile = filepath.Join(tempDir, "aliases.json")
 	aliasFile := filepath.Join(tempDir, ".azure", "aliases")
 
 	aliasContent := "test-subscription-id:test-alias\n"
@@ -149,3 +138,207 @@ func TestAliases(t *testing.T) {
 		t.Fatalf("Alias content mismatch. Got: %s, Expected: %s", aliases["test-subscription-id"], expectedAlias)
 	}
 }
+
+func TestMigrateLegacyAliases(t *testing.T) {
+	c, err := newConfig()
+	if err != nil {
+		t.Fatalf("Failed to create new config: %v", err)
+	}
+
+	tempDir := t.TempDir()
+	c.homeDir = tempDir
+	c.aliasFile = filepath.Join(tempDir, ".azure", "aliases")
+	c.stateDir = tempDir
+	c.storeFile = filepath.Join(tempDir, "aliases.json")
+	aliasFile := filepath.Join(tempDir, ".azure", "aliases")
+	os.MkdirAll(filepath.Dir(aliasFile), 0755)
+
+	// Duplicate lines are left behind by older versions appending to the file.
+	aliasContent := "sub-a:old\nsub-b:team:payments\nsub-a:new\n"
+	if err := os.WriteFile(aliasFile, []byte(aliasContent), 0644); err != nil {
+		t.Fatalf("Failed to write dummy alias file: %v", err)
+	}
+
+	aliases, err := c.aliases()
+	if err != nil {
+		t.Fatalf("Failed to load aliases: %v", err)
+	}
+	if aliases["sub-a"] != "new" || aliases["sub-b"] != "team:payments" {
+		t.Fatalf("Alias content mismatch. Got: %v", aliases)
+	}
+
+	if _, err := os.Stat(aliasFile); !os.IsNotExist(err) {
+		t.Fatalf("Expected legacy alias file to be moved away, got: %v", err)
+	}
+	if _, err := os.Stat(c.storeFile); err != nil {
+		t.Fatalf("Alias store was not created: %v", err)
+	}
+}
+
+func TestAliasLifecycle(t *testing.T) {
+	c, err := newConfig()
+	if err != nil {
+		t.Fatalf("Failed to create new config: %v", err)
+	}
+
+	tempDir := t.TempDir()
+	c.homeDir = tempDir
+	c.aliasFile = filepath.Join(tempDir, ".azure", "aliases")
+	c.stateDir = tempDir
+	c.storeFile = filepath.Join(tempDir, "aliases.json")
+
+	for id, alias := range map[string]string{"sub-a": "alpha", "sub-b": "beta", "sub-c": "gamma"} {
+		if err := c.saveAliasFile(id, alias); err != nil {
+			t.Fatalf("Failed to save alias: %v", err)
+		}
+	}
+	if err := c.saveAliasFile("sub-a", "first"); err != nil {
+		t.Fatalf("Failed to replace alias: %v", err)
+	}
+	if err := c.addAlias("sub-a", "second"); err != nil {
+		t.Fatalf("Failed to add alias: %v", err)
+	}
+
+	if err := c.saveAliasFile("sub-a", "first"); err != nil {
+		t.Fatalf("Failed to set the primary alias again: %v", err)
+	}
+	if store, _ := c.loadAliasStore(); len(store.Subscriptions["sub-a"].Aliases) != 2 {
+		t.Fatalf("Expected setting the primary alias again to keep the others, got: %v", store.Subscriptions["sub-a"].Aliases)
+	}
+
+	if _, _, err := c.removeAlias("BETA"); err != nil {
+		t.Fatalf("Failed to remove alias by name: %v", err)
+	}
+	if _, _, err := c.removeAlias("sub-c"); err != nil {
+		t.Fatalf("Failed to remove aliases by ID: %v", err)
+	}
+	if _, _, err := c.removeAlias("missing"); err == nil {
+		t.Fatalf("Expected error when removing unknown alias, got none")
+	}
+
+	if _, err := c.renameAlias("second", "third"); err != nil {
+		t.Fatalf("Failed to rename alias: %v", err)
+	}
+	if _, err := c.renameAlias("third", "first"); err == nil {
+		t.Fatalf("Expected error when renaming to an existing alias, got none")
+	}
+
+	store, err := c.loadAliasStore()
+	if err != nil {
+		t.Fatalf("Failed to load alias store: %v", err)
+	}
+	if len(store.Subscriptions) != 1 {
+		t.Fatalf("Expected only sub-a to remain, got: %v", store.Subscriptions)
+	}
+	if got := store.Subscriptions["sub-a"].Aliases; len(got) != 2 || got[0] != "first" || got[1] != "third" {
+		t.Fatalf("Alias content mismatch. Got: %v", got)
+	}
+}
+
+func TestLayeredAliasSources(t *testing.T) {
+	c, err := newConfig()
+	if err != nil {
+		t.Fatalf("Failed to create new config: %v", err)
+	}
+
+	tempDir := t.TempDir()
+	c.homeDir = tempDir
+	c.aliasFile = filepath.Join(tempDir, ".azure", "aliases")
+	c.stateDir = tempDir
+	c.storeFile = filepath.Join(tempDir, "aliases.json")
+	c.sharedStoreFiles = []aliasSource{
+		{Name: systemAliasSource, Path: filepath.Join(tempDir, "system.json")},
+		{Name: teamAliasSource, Path: filepath.Join(tempDir, "team.json")},
+	}
+
+	files := map[string]string{
+		"system.json":  `{"version": 1, "subscriptions": {"sub-a": {"aliases": ["sys-a"], "owner": "platform"}, "sub-b": {"aliases": ["sys-b"]}}}`,
+		"team.json":    `{"version": 1, "subscriptions": {"sub-a": {"aliases": ["team-a"], "tags": ["prod"]}}}`,
+		"aliases.json": `{"version": 1, "subscriptions": {"sub-a": {"note": "mine"}, "sub-c": {"aliases": ["user-c"]}}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	merged, err := c.loadMergedAliasStore()
+	if err != nil {
+		t.Fatalf("Failed to load merged aliases: %v", err)
+	}
+
+	a := merged.Subscriptions["sub-a"]
+	if a.primary() != "team-a" || a.origin.Name != teamAliasSource || a.Owner != "platform" || a.Note != "mine" || len(a.Tags) != 1 {
+		t.Fatalf("Merged sub-a mismatch. Got: %+v", a)
+	}
+	if b := merged.Subscriptions["sub-b"]; b.primary() != "sys-b" || b.origin.Name != systemAliasSource {
+		t.Fatalf("Merged sub-b mismatch. Got: %+v", b)
+	}
+	if c := merged.Subscriptions["sub-c"]; c.primary() != "user-c" || c.origin.Name != userAliasSource {
+		t.Fatalf("Merged sub-c mismatch. Got: %+v", c)
+	}
+
+	// Renaming a shared alias overrides it in the user store only.
+	if _, err := c.renameAlias("sys-b", "mine-b"); err != nil {
+		t.Fatalf("Failed to rename shared alias: %v", err)
+	}
+	if _, _, err := c.removeAlias("team-a"); err == nil {
+		t.Fatalf("Expected error when removing the only alias of a shared entry, got none")
+	}
+
+	aliases, err := c.aliases()
+	if err != nil {
+		t.Fatalf("Failed to load aliases: %v", err)
+	}
+	if aliases["sub-b"] != "mine-b" {
+		t.Fatalf("Alias content mismatch. Got: %v", aliases)
+	}
+}
+
+func TestGetSubscriptionsFromFileDetails(t *testing.T) {
+	c, err := newConfig()
+	if err != nil {
+		t.Fatalf("Failed to create new config: %v", err)
+	}
+
+	tempDir := t.TempDir()
+	c.homeDir = tempDir
+	c.aliasFile = filepath.Join(tempDir, ".azure", "aliases")
+	c.azureProfile = filepath.Join(tempDir, "azureProfile.json")
+
+	profileContent := "\xef\xbb\xbf" + `{
+		"subscriptions": [
+			{
+				"name": "Delegated",
+				"id": "test-id",
+				"isDefault": false,
+				"state": "Warned",
+				"tenantId": "managing-tenant",
+				"homeTenantId": "customer-tenant",
+				"environmentName": "AzureUSGovernment",
+				"user": {"name": "me@example.com", "type": "user"},
+				"managedByTenants": [{"tenantId": "managing-tenant"}]
+			}
+		]
+	}`
+	if err := os.WriteFile(c.azureProfile, []byte(profileContent), 0644); err != nil {
+		t.Fatalf("Failed to write dummy azureProfile.json: %v", err)
+	}
+
+	subs, err := c.getSubscriptionsFromFile()
+	if err != nil {
+		t.Fatalf("Failed to get subscriptions from file: %v", err)
+	}
+
+	s := subs[0]
+	if s.State != "Warned" || s.TenantID != "managing-tenant" || s.HomeTenantID != "customer-tenant" ||
+		s.EnvironmentName != "AzureUSGovernment" || s.User.Name != "me@example.com" || s.User.Type != "user" ||
+		len(s.ManagedByTenants) != 1 || s.ManagedByTenants[0].TenantID != "managing-tenant" {
+		t.Fatalf("Subscription content mismatch. Got: %+v", s)
+	}
+
+	delegated := subscriptionAlias{TenantID: s.TenantID, HomeTenantID: s.HomeTenantID}
+	if !delegated.delegated() {
+		t.Fatalf("Expected subscription to be delegated")
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// aliasStoreVersion is the current version of the alias store format.
+const aliasStoreVersion = 1
+
+// aliasStore is the on-disk alias store, keyed by subscription ID. Tenant
+// aliases are keyed by tenant ID.
+type aliasStore struct {
+	Version       int                          `json:"version"`
+	Subscriptions map[string]*subscriptionMeta `json:"subscriptions"`
+	Tenants       map[string]*tenantMeta       `json:"tenants,omitempty"`
+}
+
+// subscriptionMeta holds everything az-wrap knows about a subscription
+// beyond what the Azure CLI reports. The first alias is the primary one.
+type subscriptionMeta struct {
+	Aliases []string `json:"aliases,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Note    string   `json:"note,omitempty"`
+	Owner   string   `json:"owner,omitempty"`
+	Color   string   `json:"color,omitempty"`
+	// Pinned subscriptions are listed first.
+	Pinned bool `json:"pinned,omitempty"`
+
+	// origin is the alias source the aliases were taken from when merged.
+	origin aliasSource
+}
+
+// tenantMeta holds the aliases of a tenant. The first alias is the primary one.
+type tenantMeta struct {
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+const (
+	systemAliasSource = "system"
+	teamAliasSource   = "team"
+	userAliasSource   = "user"
+)
+
+// aliasSource is an alias store file. Only the user source is ever written,
+// the others are shared by several users.
+type aliasSource struct {
+	Name string
+	Path string
+}
+
+func (s aliasSource) String() string {
+	return fmt.Sprintf("%s (%s)", s.Name, s.Path)
+}
+
+// sharedAliasSources returns the shared alias stores from lowest to highest
+// precedence: the system wide store followed by every team store listed in
+// AZ_WRAP_TEAM_ALIASES. The user store always takes precedence over them.
+func sharedAliasSources() []aliasSource {
+	systemDir := "/etc/az-wrap"
+	if runtime.GOOS == "windows" {
+		systemDir = filepath.Join(os.Getenv("ProgramData"), "az-wrap")
+	}
+	sources := []aliasSource{{Name: systemAliasSource, Path: filepath.Join(systemDir, "aliases.json")}}
+	for _, path := range filepath.SplitList(os.Getenv("AZ_WRAP_TEAM_ALIASES")) {
+		if path != "" {
+			sources = append(sources, aliasSource{Name: teamAliasSource, Path: path})
+		}
+	}
+	return sources
+}
+
+// aliasColors are the color names accepted for a subscription.
+var aliasColors = map[string]color.Attribute{
+	"red":     color.FgRed,
+	"green":   color.FgGreen,
+	"yellow":  color.FgYellow,
+	"blue":    color.FgBlue,
+	"magenta": color.FgMagenta,
+	"cyan":    color.FgCyan,
+	"white":   color.FgWhite,
+}
+
+// colorNames returns the accepted color names in alphabetical order.
+func colorNames() []string {
+	names := make([]string, 0, len(aliasColors))
+	for name := range aliasColors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newAliasStore() *aliasStore {
+	return &aliasStore{
+		Version:       aliasStoreVersion,
+		Subscriptions: make(map[string]*subscriptionMeta),
+		Tenants:       make(map[string]*tenantMeta),
+	}
+}
+
+// meta returns the metadata for a subscription, creating it if needed.
+func (s *aliasStore) meta(subscriptionId string) *subscriptionMeta {
+	m, ok := s.Subscriptions[subscriptionId]
+	if !ok {
+		m = &subscriptionMeta{}
+		s.Subscriptions[subscriptionId] = m
+	}
+	return m
+}
+
+// lookup returns the subscription ID owning an alias, ignoring case.
+func (s *aliasStore) lookup(alias string) (string, bool) {
+	for id, m := range s.Subscriptions {
+		if m.hasAlias(alias) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// ids returns the subscription IDs in the store ordered by primary alias.
+func (s *aliasStore) ids() []string {
+	ids := make([]string, 0, len(s.Subscriptions))
+	for id := range s.Subscriptions {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.Subscriptions[ids[i]].primary(), s.Subscriptions[ids[j]].primary()
+		if a != b {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// prune drops subscriptions and tenants that no longer carry any information.
+func (s *aliasStore) prune() {
+	for id, m := range s.Subscriptions {
+		if m.empty() {
+			delete(s.Subscriptions, id)
+		}
+	}
+	for id, t := range s.Tenants {
+		if len(t.Aliases) == 0 {
+			delete(s.Tenants, id)
+		}
+	}
+}
+
+func (m *subscriptionMeta) primary() string {
+	if len(m.Aliases) == 0 {
+		return ""
+	}
+	return m.Aliases[0]
+}
+
+func (m *subscriptionMeta) hasAlias(alias string) bool {
+	return m.aliasIndex(alias) >= 0
+}
+
+func (m *subscriptionMeta) aliasIndex(alias string) int {
+	for i, a := range m.Aliases {
+		if strings.EqualFold(a, alias) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *subscriptionMeta) empty() bool {
+	return len(m.Aliases) == 0 && len(m.Tags) == 0 && m.Note == "" && m.Owner == "" && m.Color == "" && !m.Pinned
+}
+
+// loadMergedAliasStore merges the shared alias stores and the user store.
+// For every field of a subscription the highest precedence source that sets
+// it wins.
+func (c *config) loadMergedAliasStore() (*aliasStore, error) {
+	_, merged, err := c.loadAliasStores()
+	return merged, err
+}
+
+// loadAliasStores returns the user store, which is the only one az-wrap
+// writes to, together with the merged view of all alias sources.
+func (c *config) loadAliasStores() (*aliasStore, *aliasStore, error) {
+	merged, err := c.loadSharedAliasStores()
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := c.loadAliasStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	merged.merge(user, aliasSource{Name: userAliasSource, Path: c.storeFile})
+	return user, merged, nil
+}
+
+// loadSharedAliasStores merges the system and team alias files.
+func (c *config) loadSharedAliasStores() (*aliasStore, error) {
+	merged := newAliasStore()
+	for _, src := range c.sharedStoreFiles {
+		data, err := os.ReadFile(src.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s alias file %s: %w", src.Name, src.Path, err)
+		}
+		store, err := parseAliasStore(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s alias file %s: %w", src.Name, src.Path, err)
+		}
+		merged.merge(store, src)
+	}
+	return merged, nil
+}
+
+// merge layers other on top of s.
+func (s *aliasStore) merge(other *aliasStore, origin aliasSource) {
+	for id, o := range other.Subscriptions {
+		m := s.meta(id)
+		if len(o.Aliases) > 0 {
+			m.Aliases = append([]string(nil), o.Aliases...)
+			m.origin = origin
+		}
+		if len(o.Tags) > 0 {
+			m.Tags = append([]string(nil), o.Tags...)
+		}
+		if o.Note != "" {
+			m.Note = o.Note
+		}
+		if o.Owner != "" {
+			m.Owner = o.Owner
+		}
+		if o.Color != "" {
+			m.Color = o.Color
+		}
+		if o.Pinned {
+			m.Pinned = true
+		}
+	}
+	for id, t := range other.Tenants {
+		if len(t.Aliases) > 0 {
+			s.Tenants[id] = &tenantMeta{Aliases: append([]string(nil), t.Aliases...)}
+		}
+	}
+}
+
+// editableMeta returns the user metadata of a subscription for editing. When
+// the user store has no aliases for it yet, the merged aliases are copied in
+// so that edits build on what the user currently sees.
+func (s *aliasStore) editableMeta(merged *aliasStore, subscriptionId string) *subscriptionMeta {
+	m := s.meta(subscriptionId)
+	if mm, ok := merged.Subscriptions[subscriptionId]; ok && len(m.Aliases) == 0 {
+		m.Aliases = append([]string(nil), mm.Aliases...)
+	}
+	return m
+}
+
+// loadAliasStore reads the user alias store, migrating the legacy alias file on
+// first use.
+func (c *config) loadAliasStore() (*aliasStore, error) {
+	data, err := os.ReadFile(c.storeFile)
+	if os.IsNotExist(err) {
+		return c.migrateLegacyAliases()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read alias store: %w", err)
+	}
+	return parseAliasStore(data)
+}
+
+func parseAliasStore(data []byte) (*aliasStore, error) {
+	store := newAliasStore()
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("unable to parse alias store: %w", err)
+	}
+	if store.Version > aliasStoreVersion {
+		return nil, fmt.Errorf("alias store version %d is newer than supported version %d, please upgrade az-wrap", store.Version, aliasStoreVersion)
+	}
+	if store.Subscriptions == nil {
+		store.Subscriptions = make(map[string]*subscriptionMeta)
+	}
+	if store.Tenants == nil {
+		store.Tenants = make(map[string]*tenantMeta)
+	}
+	for id, m := range store.Subscriptions {
+		if m == nil {
+			delete(store.Subscriptions, id)
+		}
+	}
+	for id, t := range store.Tenants {
+		if t == nil {
+			delete(store.Tenants, id)
+		}
+	}
+	store.Version = aliasStoreVersion
+	return store, nil
+}
+
+// saveAliasStore writes the alias store to disk.
+func (c *config) saveAliasStore(store *aliasStore) error {
+	store.prune()
+	store.Version = aliasStoreVersion
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode alias store: %w", err)
+	}
+	if err := writeFileAtomic(c.storeFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("unable to write alias store: %w", err)
+	}
+	return nil
+}
+
+// migrateLegacyAliases converts the legacy id:alias file into the alias
+// store. The legacy file is kept as aliases.bak afterwards.
+func (c *config) migrateLegacyAliases() (*aliasStore, error) {
+	store := newAliasStore()
+	legacyFile, err := c.checkAliasFile()
+	if err != nil {
+		return store, nil // No aliases file is not a hard error.
+	}
+
+	entries, err := readLegacyAliases(legacyFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		store.meta(e.ID).Aliases = []string{e.Alias}
+	}
+
+	if err := c.saveAliasStore(store); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(legacyFile, legacyFile+".bak"); err != nil {
+		return nil, fmt.Errorf("unable to move legacy alias file: %w", err)
+	}
+	return store, nil
+}
+
+// legacyAliasEntry is a single line of the legacy alias file.
+type legacyAliasEntry struct {
+	ID    string
+	Alias string
+}
+
+// readLegacyAliases parses the legacy id:alias file. When a subscription ID
+// appears more than once the last line wins.
+func readLegacyAliases(file string) ([]legacyAliasEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error opening alias file: %w", err)
+	}
+
+	var entries []legacyAliasEntry
+	seen := make(map[string]int)
+	for _, line := range strings.Split(string(data), "\n") {
+		id, alias, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || id == "" || alias == "" {
+			continue
+		}
+		if i, ok := seen[id]; ok {
+			entries[i].Alias = alias
+			continue
+		}
+		seen[id] = len(entries)
+		entries = append(entries, legacyAliasEntry{ID: id, Alias: alias})
+	}
+	return entries, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames
+// it over name, so a failed write never leaves a half-written file behind.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+// aliasRule rewrites subscription names matching Match into an alias using
+// Template, which can refer to capture groups as $1 or ${name}.
+type aliasRule struct {
+	Match    string `json:"match"`
+	Template string `json:"template"`
+
+	re *regexp.Regexp
+}
+
+// aliasSuggestion is a generated alias for an unaliased subscription.
+type aliasSuggestion struct {
+	Subscription subscriptionAlias
+	Alias        string
+	Rule         string
+	Problem      *aliasValidationError
+}
+
+// loadAliasRules reads the rules file. Rules are tried in order and the first
+// matching rule wins.
+func loadAliasRules(file string) ([]aliasRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rules file: %w", err)
+	}
+
+	var f struct {
+		Rules []aliasRule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("unable to parse rules file %s: %w", file, err)
+	}
+	for i := range f.Rules {
+		re, err := regexp.Compile(f.Rules[i].Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d in %s: %w", i+1, file, err)
+		}
+		f.Rules[i].re = re
+	}
+	return f.Rules, nil
+}
+
+// apply returns the alias the rule generates for name, if it matches.
+func (r aliasRule) apply(name string) (string, bool) {
+	match := r.re.FindStringSubmatchIndex(name)
+	if match == nil {
+		return "", false
+	}
+	alias := r.re.ExpandString(nil, r.Template, name, match)
+	return string(alias), len(alias) > 0
+}
+
+// suggestAliases generates aliases for every subscription without one. Each
+// suggestion is validated against the subscriptions, the existing aliases and
+// the suggestions made before it.
+func suggestAliases(subs []subscriptionAlias, store *aliasStore, rules []aliasRule) []aliasSuggestion {
+	planned := newAliasStore()
+	planned.merge(store, aliasSource{})
+
+	var suggestions []aliasSuggestion
+	for _, s := range subs {
+		if len(s.Aliases) > 0 {
+			continue
+		}
+		for _, r := range rules {
+			alias, ok := r.apply(s.Name)
+			if !ok {
+				continue
+			}
+			suggestion := aliasSuggestion{Subscription: s, Alias: alias, Rule: r.Match}
+			if err := validateAlias(subs, planned, s.ID, alias); err != nil {
+				suggestion.Problem = err.(*aliasValidationError)
+			} else {
+				planned.meta(s.ID).Aliases = []string{alias}
+			}
+			suggestions = append(suggestions, suggestion)
+			break
+		}
+	}
+	return suggestions
+}
+
+// runAliasSuggest previews suggested aliases and optionally saves them.
+func runAliasSuggest(cfg *config, rulesFile string, apply, force bool) error {
+	rules, err := loadAliasRules(rulesFile)
+	if err != nil {
+		return err
+	}
+	subs, err := cfg.subscriptionAliases()
+	if err != nil {
+		return err
+	}
+	user, merged, err := cfg.loadAliasStores()
+	if err != nil {
+		return err
+	}
+
+	suggestions := suggestAliases(subs, merged, rules)
+	if len(suggestions) == 0 {
+		fmt.Println("No suggestions, every matching subscription already has an alias")
+		return nil
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	problemFmt := color.New(color.FgRed).SprintFunc()
+
+	tbl := table.New("Index", "Name", "Suggested alias", "Status")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWidthFunc(visibleWidth)
+	applied := 0
+	for _, s := range suggestions {
+		status := "ok"
+		if s.Problem != nil {
+			status = problemFmt(s.Problem.Problems[0])
+		}
+		if apply && (s.Problem == nil || force) {
+			user.editableMeta(merged, s.Subscription.ID).Aliases = []string{s.Alias}
+			applied++
+		}
+		tbl.AddRow(s.Subscription.Index, s.Subscription.Name, s.Alias, status)
+	}
+	tbl.Print()
+
+	if !apply {
+		fmt.Println("\nRun again with -apply to save the suggestions marked ok.")
+		return nil
+	}
+	if err := cfg.saveAliasStore(user); err != nil {
+		return err
+	}
+	fmt.Printf("\nSaved %d of %d suggested aliases.\n", applied, len(suggestions))
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSuggestAliases(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.json")
+	rulesContent := `{"rules": [
+		{"match": "^corp-\\d+-\\w+-(?P<env>\\w+)-(?P<app>\\w+)$", "template": "${app}-${env}"},
+		{"match": "^(?P<name>\\w+)$", "template": "$name"}
+	]}`
+	if err := os.WriteFile(rulesFile, []byte(rulesContent), 0644); err != nil {
+		t.Fatalf("Failed to write rules file: %v", err)
+	}
+
+	rules, err := loadAliasRules(rulesFile)
+	if err != nil {
+		t.Fatalf("Failed to load rules: %v", err)
+	}
+
+	subs := []subscriptionAlias{
+		{Index: 1, Name: "corp-0042-weu-prod-payments", ID: testSubA},
+		{Index: 2, Name: "corp-0043-neu-prod-payments", ID: testSubB},
+		{Index: 3, Name: "sandbox", ID: testSubC, Aliases: []string{"sbx"}},
+	}
+
+	suggestions := suggestAliases(subs, newAliasStore(), rules)
+	if len(suggestions) != 2 {
+		t.Fatalf("Expected 2 suggestions, got: %+v", suggestions)
+	}
+	if s := suggestions[0]; s.Alias != "payments-prod" || s.Problem != nil {
+		t.Fatalf("Unexpected first suggestion: %+v", s)
+	}
+	// The second subscription would get the same alias, which must be flagged.
+	if s := suggestions[1]; s.Alias != "payments-prod" || s.Problem == nil {
+		t.Fatalf("Expected duplicate suggestion to be rejected, got: %+v", s)
+	}
+}
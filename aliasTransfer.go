@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// csvHeader is the header of the CSV export. List values are separated by ';'.
+var csvHeader = []string{"id", "name", "aliases", "tags", "owner", "color", "note", "pinned"}
+
+// exportAliases writes the merged alias stores in the given format.
+// names maps subscription IDs to subscription names and may be empty.
+func exportAliases(w io.Writer, store *aliasStore, names map[string]string, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(store, "", "  ")
+		if err != nil {
+			return fmt.Errorf("unable to encode aliases: %w", err)
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, id := range store.ids() {
+			m := store.Subscriptions[id]
+			pinned := ""
+			if m.Pinned {
+				pinned = "true"
+			}
+			cw.Write([]string{id, names[id], strings.Join(m.Aliases, ";"), strings.Join(m.Tags, ";"), m.Owner, m.Color, m.Note, pinned})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "md", "markdown":
+		esc := strings.NewReplacer("|", `\|`, "\n", " ")
+		fmt.Fprintln(w, "| Alias | Name | Subscription ID | Tags | Owner | Note | Pinned |")
+		fmt.Fprintln(w, "| --- | --- | --- | --- | --- | --- | --- |")
+		for _, id := range store.ids() {
+			m := store.Subscriptions[id]
+			pinned := ""
+			if m.Pinned {
+				pinned = "yes"
+			}
+			fmt.Fprintf(w, "| %s | %s | `%s` | %s | %s | %s | %s |\n",
+				esc.Replace(strings.Join(m.Aliases, ", ")), esc.Replace(names[id]), id,
+				esc.Replace(strings.Join(m.Tags, ", ")), esc.Replace(m.Owner), esc.Replace(m.Note), pinned)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown export format '%s', use json, csv or md", format)
+	}
+}
+
+// readAliasImport reads an alias file in JSON or CSV format. An empty format
+// is derived from the file extension.
+func readAliasImport(file, format string) (*aliasStore, error) {
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(file), ".csv") {
+			format = "csv"
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open import file: %w", err)
+	}
+	defer f.Close()
+
+	switch format {
+	case "json":
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read import file: %w", err)
+		}
+		return parseAliasStore(data)
+	case "csv":
+		return parseAliasCSV(f)
+	default:
+		return nil, fmt.Errorf("unknown import format '%s', use json or csv", format)
+	}
+}
+
+// parseAliasCSV parses the format written by exportAliases. Columns are
+// matched by header name, so the order and the name column do not matter.
+func parseAliasCSV(r io.Reader) (*aliasStore, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["id"]; !ok {
+		return nil, fmt.Errorf("CSV file has no id column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	list := func(s string) []string {
+		return splitList(strings.ReplaceAll(s, ";", ","))
+	}
+
+	store := newAliasStore()
+	for _, record := range records[1:] {
+		id := field(record, "id")
+		if id == "" {
+			continue
+		}
+		m := store.meta(id)
+		m.Aliases = list(field(record, "aliases"))
+		m.Tags = list(field(record, "tags"))
+		m.Owner = field(record, "owner")
+		m.Color = field(record, "color")
+		m.Note = field(record, "note")
+		if pinned := field(record, "pinned"); pinned != "" {
+			if m.Pinned, err = strconv.ParseBool(pinned); err != nil {
+				return nil, fmt.Errorf("invalid pinned value '%s' for %s", pinned, id)
+			}
+		}
+	}
+	store.prune()
+	return store, nil
+}
+
+// importChange describes what an import does to a single subscription.
+type importChange struct {
+	ID        string
+	Action    string
+	Conflicts []string
+	// Problems are the validation problems of the imported aliases.
+	Problems []string
+}
+
+// validateImport validates the aliases of every added or updated
+// subscription against the subscriptions and the alias store after the
+// import, see validateAlias. It returns the number of invalid aliases.
+func validateImport(subs []subscriptionAlias, result *aliasStore, changes []importChange) int {
+	invalid := 0
+	for i, ch := range changes {
+		m := result.Subscriptions[ch.ID]
+		if ch.Action == "remove" || m == nil {
+			continue
+		}
+		for _, alias := range m.Aliases {
+			var validationErr *aliasValidationError
+			if errors.As(validateAlias(subs, result, ch.ID, alias), &validationErr) {
+				changes[i].Problems = append(changes[i].Problems, validationErr.Problems...)
+				invalid++
+			}
+		}
+	}
+	return invalid
+}
+
+// planImport applies incoming to a copy of current and reports the change
+// for every subscription. In replace mode subscriptions missing from
+// incoming are removed, otherwise they are kept and incoming fields override
+// existing ones.
+func planImport(current, incoming *aliasStore, replace bool) (*aliasStore, []importChange) {
+	result := newAliasStore()
+	if !replace {
+		result.merge(current, aliasSource{})
+	}
+
+	var changes []importChange
+	for _, id := range incoming.ids() {
+		in := incoming.Subscriptions[id]
+		if replace {
+			result.Subscriptions[id] = in
+		} else {
+			result.merge(&aliasStore{Subscriptions: map[string]*subscriptionMeta{id: in}}, aliasSource{})
+		}
+
+		old, exists := current.Subscriptions[id]
+		if !exists || old.empty() {
+			changes = append(changes, importChange{ID: id, Action: "add"})
+			continue
+		}
+
+		var conflicts []string
+		diff := func(field string, oldValue, newValue interface{}, set bool) {
+			if set && !reflect.ValueOf(oldValue).IsZero() && !reflect.DeepEqual(oldValue, newValue) {
+				conflicts = append(conflicts, fmt.Sprintf("%s %v -> %v", field, oldValue, newValue))
+			}
+		}
+		diff("aliases", old.Aliases, in.Aliases, replace || len(in.Aliases) > 0)
+		diff("tags", old.Tags, in.Tags, replace || len(in.Tags) > 0)
+		diff("owner", old.Owner, in.Owner, replace || in.Owner != "")
+		diff("color", old.Color, in.Color, replace || in.Color != "")
+		diff("note", old.Note, in.Note, replace || in.Note != "")
+		diff("pinned", old.Pinned, in.Pinned, replace)
+
+		action := "update"
+		if reflect.DeepEqual(old, result.Subscriptions[id]) {
+			action = "unchanged"
+		}
+		changes = append(changes, importChange{ID: id, Action: action, Conflicts: conflicts})
+	}
+
+	if replace {
+		for _, id := range current.ids() {
+			if _, ok := incoming.Subscriptions[id]; !ok {
+				changes = append(changes, importChange{ID: id, Action: "remove"})
+			}
+		}
+	}
+	result.merge(&aliasStore{Tenants: incoming.Tenants}, aliasSource{})
+	return result, changes
+}
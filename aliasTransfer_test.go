@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportImportCSV(t *testing.T) {
+	store := newAliasStore()
+	store.Subscriptions["sub-a"] = &subscriptionMeta{Aliases: []string{"pay", "payments"}, Tags: []string{"prod"}, Owner: "team, a", Note: "Payments \"API\""}
+	store.Subscriptions["sub-b"] = &subscriptionMeta{Aliases: []string{"dev"}, Color: "green", Pinned: true}
+
+	var buf bytes.Buffer
+	if err := exportAliases(&buf, store, map[string]string{"sub-a": "corp-payments"}, "csv"); err != nil {
+		t.Fatalf("Failed to export CSV: %v", err)
+	}
+
+	imported, err := parseAliasCSV(&buf)
+	if err != nil {
+		t.Fatalf("Failed to parse exported CSV: %v", err)
+	}
+	for id, want := range store.Subscriptions {
+		got := imported.Subscriptions[id]
+		if got == nil || strings.Join(got.Aliases, ",") != strings.Join(want.Aliases, ",") || got.Owner != want.Owner || got.Note != want.Note || got.Color != want.Color || got.Pinned != want.Pinned {
+			t.Fatalf("Round trip mismatch for %s. Got: %+v, Expected: %+v", id, got, want)
+		}
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	store := newAliasStore()
+	store.Subscriptions["sub-a"] = &subscriptionMeta{Aliases: []string{"pay"}, Note: "a|b", Pinned: true}
+
+	var buf bytes.Buffer
+	if err := exportAliases(&buf, store, map[string]string{"sub-a": "corp-payments"}, "md"); err != nil {
+		t.Fatalf("Failed to export Markdown: %v", err)
+	}
+
+	expected := "| pay | corp-payments | `sub-a` |  |  | a\\|b | yes |"
+	if !strings.Contains(buf.String(), expected) {
+		t.Fatalf("Markdown export mismatch. Got:\n%s", buf.String())
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	current := newAliasStore()
+	current.Subscriptions["sub-a"] = &subscriptionMeta{Aliases: []string{"old"}, Owner: "me"}
+	current.Subscriptions["sub-b"] = &subscriptionMeta{Aliases: []string{"keep"}}
+
+	incoming := newAliasStore()
+	incoming.Subscriptions["sub-a"] = &subscriptionMeta{Aliases: []string{"new"}}
+	incoming.Subscriptions["sub-c"] = &subscriptionMeta{Aliases: []string{"added"}}
+
+	merged, changes := planImport(current, incoming, false)
+	if len(changes) != 2 || changes[0].ID != "sub-c" || changes[0].Action != "add" {
+		t.Fatalf("Unexpected merge changes: %+v", changes)
+	}
+	if changes[1].Action != "update" || len(changes[1].Conflicts) != 1 {
+		t.Fatalf("Expected one alias conflict for sub-a, got: %+v", changes[1])
+	}
+	if a := merged.Subscriptions["sub-a"]; a.primary() != "new" || a.Owner != "me" {
+		t.Fatalf("Merged sub-a mismatch. Got: %+v", a)
+	}
+	if _, ok := merged.Subscriptions["sub-b"]; !ok {
+		t.Fatalf("Merge removed sub-b")
+	}
+
+	replaced, changes := planImport(current, incoming, true)
+	if _, ok := replaced.Subscriptions["sub-b"]; ok {
+		t.Fatalf("Replace kept sub-b")
+	}
+	if a := replaced.Subscriptions["sub-a"]; a.Owner != "" {
+		t.Fatalf("Replace kept owner of sub-a. Got: %+v", a)
+	}
+	if last := changes[len(changes)-1]; last.ID != "sub-b" || last.Action != "remove" {
+		t.Fatalf("Expected sub-b to be removed, got: %+v", changes)
+	}
+}
+
+func TestValidateImport(t *testing.T) {
+	subs := []subscriptionAlias{
+		{Name: "payments-prod", ID: testSubA, Index: 1},
+		{Name: "payments-dev", ID: testSubB, Index: 2},
+	}
+	incoming := newAliasStore()
+	incoming.Subscriptions[testSubA] = &subscriptionMeta{Aliases: []string{"pay"}}
+	incoming.Subscriptions[testSubB] = &subscriptionMeta{Aliases: []string{"payments-prod"}}
+	incoming.Subscriptions[testSubC] = &subscriptionMeta{Aliases: []string{"other"}}
+
+	result, changes := planImport(newAliasStore(), incoming, false)
+	if invalid := validateImport(subs, result, changes); invalid != 2 {
+		t.Fatalf("Expected two invalid aliases, got %d: %+v", invalid, changes)
+	}
+	for _, ch := range changes {
+		if expected := ch.ID != testSubA; (len(ch.Problems) > 0) != expected {
+			t.Errorf("Expected problems for %s: %v, got: %v", ch.ID, expected, ch.Problems)
+		}
+	}
+}
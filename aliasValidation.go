@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+var guidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// aliasProblem is a single finding of the alias audit.
+type aliasProblem struct {
+	Kind   string
+	Alias  string
+	ID     string
+	Detail string
+}
+
+// aliasValidationError lists every reason an alias was rejected.
+type aliasValidationError struct {
+	Alias    string
+	Problems []string
+}
+
+func (e *aliasValidationError) Error() string {
+	return fmt.Sprintf("invalid alias '%s':\n  - %s\nUse -force to set it anyway", e.Alias, strings.Join(e.Problems, "\n  - "))
+}
+
+// validateAlias checks that alias can be given to the subscription without
+// making selection ambiguous. subs are the loaded subscriptions and store is
+// the merged alias store.
+func validateAlias(subs []subscriptionAlias, store *aliasStore, subscriptionId, alias string) error {
+	var problems []string
+	if strings.TrimSpace(alias) == "" {
+		problems = append(problems, "the alias is empty")
+	}
+	if !guidPattern.MatchString(subscriptionId) {
+		problems = append(problems, fmt.Sprintf("'%s' is not a valid subscription ID", subscriptionId))
+	} else if !hasSubscription(subs, subscriptionId) {
+		problems = append(problems, fmt.Sprintf("subscription ID '%s' is not one of your %d subscriptions, check 'az login'", subscriptionId, len(subs)))
+	}
+	if owner, ok := store.lookup(alias); ok && !strings.EqualFold(owner, subscriptionId) {
+		problems = append(problems, fmt.Sprintf("alias '%s' is already used by subscription ID '%s'", alias, owner))
+	}
+	for _, p := range selectionClashes(subs, subscriptionId, alias) {
+		problems = append(problems, p.Detail)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return &aliasValidationError{Alias: alias, Problems: problems}
+}
+
+// selectionClashes reports where alias equals the index, name or ID of
+// another subscription, so selecting it would be ambiguous.
+func selectionClashes(subs []subscriptionAlias, subscriptionId, alias string) []aliasProblem {
+	var problems []aliasProblem
+	clash := func(s subscriptionAlias, what string) {
+		problems = append(problems, aliasProblem{
+			Kind:   "ambiguous",
+			Alias:  alias,
+			ID:     subscriptionId,
+			Detail: fmt.Sprintf("alias '%s' equals the %s of subscription '%s' (%s)", alias, what, s.Name, s.ID),
+		})
+	}
+
+	if n, err := strconv.Atoi(alias); err == nil && n >= 1 && n <= len(subs) {
+		if s := subs[n-1]; !strings.EqualFold(s.ID, subscriptionId) {
+			clash(s, "index")
+		}
+	}
+	for _, s := range subs {
+		if strings.EqualFold(s.ID, subscriptionId) {
+			continue
+		}
+		if strings.EqualFold(s.Name, alias) {
+			clash(s, "name")
+		}
+		if strings.EqualFold(s.ID, alias) {
+			clash(s, "ID")
+		}
+	}
+	return problems
+}
+
+// checkAliases audits the merged alias store for aliases pointing at unknown
+// subscriptions and aliases that make selection ambiguous.
+func checkAliases(subs []subscriptionAlias, store *aliasStore) []aliasProblem {
+	var problems []aliasProblem
+	owners := make(map[string][]string)
+	for _, id := range store.ids() {
+		m := store.Subscriptions[id]
+		switch {
+		case !guidPattern.MatchString(id):
+			problems = append(problems, aliasProblem{Kind: "invalid", Alias: strings.Join(m.Aliases, ", "), ID: id, Detail: "not a valid subscription ID"})
+		case !hasSubscription(subs, id):
+			problems = append(problems, aliasProblem{Kind: "dangling", Alias: strings.Join(m.Aliases, ", "), ID: id, Detail: "subscription not found in your subscriptions"})
+		}
+		for _, alias := range m.Aliases {
+			key := strings.ToLower(alias)
+			owners[key] = append(owners[key], id)
+			problems = append(problems, selectionClashes(subs, id, alias)...)
+		}
+	}
+
+	for _, id := range store.ids() {
+		for _, alias := range store.Subscriptions[id].Aliases {
+			if ids := owners[strings.ToLower(alias)]; len(ids) > 1 && ids[0] == id {
+				problems = append(problems, aliasProblem{
+					Kind:   "ambiguous",
+					Alias:  alias,
+					ID:     strings.Join(ids, ", "),
+					Detail: fmt.Sprintf("alias is used by %d subscriptions", len(ids)),
+				})
+			}
+		}
+	}
+	return problems
+}
+
+func hasSubscription(subs []subscriptionAlias, subscriptionId string) bool {
+	for _, s := range subs {
+		if strings.EqualFold(s.ID, subscriptionId) {
+			return true
+		}
+	}
+	return false
+}
+
+// runAliasCheck prints the alias audit and fails when problems are found.
+func runAliasCheck(cfg *config) error {
+	subs, err := cfg.subscriptionAliases()
+	if err != nil {
+		return err
+	}
+	store, err := cfg.loadMergedAliasStore()
+	if err != nil {
+		return err
+	}
+
+	problems := checkAliases(subs, store)
+	if len(problems) == 0 {
+		color.New(color.FgGreen).Printf("All aliases of %d subscriptions are valid.\n", len(store.Subscriptions))
+		return nil
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgRed).SprintfFunc()
+
+	tbl := table.New("Problem", "Alias", "ID", "Detail")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, p := range problems {
+		tbl.AddRow(p.Kind, p.Alias, p.ID, p.Detail)
+	}
+	tbl.Print()
+	return fmt.Errorf("found %d alias problems", len(problems))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	testSubA = "11111111-1111-1111-1111-111111111111"
+	testSubB = "22222222-2222-2222-2222-222222222222"
+	testSubC = "33333333-3333-3333-3333-333333333333"
+)
+
+func testSubscriptions() []subscriptionAlias {
+	return []subscriptionAlias{
+		{Index: 1, Name: "corp-payments-prod", ID: testSubA},
+		{Index: 2, Name: "corp-payments-dev", ID: testSubB},
+	}
+}
+
+func TestValidateAlias(t *testing.T) {
+	store := newAliasStore()
+	store.Subscriptions[testSubB] = &subscriptionMeta{Aliases: []string{"dev"}}
+
+	tests := []struct {
+		name    string
+		id      string
+		alias   string
+		problem string
+	}{
+		{"valid", testSubA, "prod", ""},
+		{"own name", testSubA, "corp-payments-prod", ""},
+		{"not a guid", "test-subscription-id", "prod", "not a valid subscription ID"},
+		{"no access", testSubC, "prod", "not one of your 2 subscriptions"},
+		{"taken", testSubA, "DEV", "already used by subscription ID"},
+		{"other name", testSubA, "corp-payments-dev", "equals the name of subscription"},
+		{"other index", testSubA, "2", "equals the index of subscription"},
+		{"empty", testSubA, " ", "the alias is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAlias(testSubscriptions(), store, tt.id, tt.alias)
+			if tt.problem == "" {
+				if err != nil {
+					t.Fatalf("Expected alias to be valid, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Fatalf("Expected error containing %q, got: %v", tt.problem, err)
+			}
+		})
+	}
+}
+
+func TestCheckAliases(t *testing.T) {
+	store := newAliasStore()
+	store.Subscriptions[testSubA] = &subscriptionMeta{Aliases: []string{"pay"}}
+	store.Subscriptions[testSubB] = &subscriptionMeta{Aliases: []string{"pay", "1"}}
+	store.Subscriptions[testSubC] = &subscriptionMeta{Aliases: []string{"gone"}}
+
+	kinds := make(map[string]int)
+	for _, p := range checkAliases(testSubscriptions(), store) {
+		kinds[p.Kind]++
+	}
+	if kinds["dangling"] != 1 || kinds["ambiguous"] != 2 || len(kinds) != 2 {
+		t.Fatalf("Unexpected audit result: %v", kinds)
+	}
+}
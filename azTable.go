@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+const azUsage = `Usage: az-wrap az [-columns <paths>] [-sort <column>] [-reverse] [-raw] <az arguments>
+
+Runs an Azure CLI command and prints lists as tables. The flags of az-wrap go
+before the az arguments:
+
+  -columns <paths>  Comma separated columns, such as name,hardwareProfile.vmSize,tags.env
+  -sort <column>    Sort by a column header or path
+  -reverse          Reverse the order
+  -raw              Print the JSON of az as is
+
+Only list, show and query commands are printed as tables, and results that
+are not lists as JSON. Any other command, such as one asking to confirm a
+delete, arguments choosing an output format with -o or --output, and -h or
+--help pass the output of az through.`
+
+// azColumn is a column of an az table. Path is a dotted path into the
+// objects az returns, with numbers indexing arrays.
+type azColumn struct {
+	Header string
+	Path   string
+	// Status columns are colored by their value, see statusColor.
+	Status bool
+}
+
+// azRenderers are the default columns of resource types, by the type field
+// of the objects. Columns without any value are left out, such as the power
+// state of 'az vm list' without -d.
+var azRenderers = map[string][]azColumn{
+	"microsoft.compute/virtualmachines": {
+		{Header: "Name", Path: "name"},
+		{Header: "Resource group", Path: "resourceGroup"},
+		{Header: "Location", Path: "location"},
+		{Header: "Size", Path: "hardwareProfile.vmSize"},
+		{Header: "OS", Path: "storageProfile.osDisk.osType"},
+		{Header: "Power state", Path: "powerState", Status: true},
+		{Header: "Private IPs", Path: "privateIps"},
+		{Header: "Public IPs", Path: "publicIps"},
+		{Header: "State", Path: "provisioningState", Status: true},
+	},
+	"microsoft.resources/resourcegroups": {
+		{Header: "Name", Path: "name"},
+		{Header: "Location", Path: "location"},
+		{Header: "State", Path: "properties.provisioningState", Status: true},
+		{Header: "Managed by", Path: "managedBy"},
+		{Header: "Tags", Path: "tags"},
+	},
+	"microsoft.web/sites": {
+		{Header: "Name", Path: "name"},
+		{Header: "Resource group", Path: "resourceGroup"},
+		{Header: "Location", Path: "location"},
+		{Header: "Kind", Path: "kind"},
+		{Header: "State", Path: "state", Status: true},
+		{Header: "Host", Path: "defaultHostName"},
+		{Header: "Runtime", Path: "siteConfig.linuxFxVersion"},
+	},
+}
+
+// azPreferredFields come first among the default columns of other types.
+var azPreferredFields = []string{"name", "displayName", "resourceGroup", "location", "type", "kind", "state", "provisioningState"}
+
+// maxAzColumns limits the default columns of types without a renderer.
+const maxAzColumns = 8
+
+// lookupPath returns the value at a dotted path, matching keys without
+// regard to case when there is no exact match.
+func lookupPath(v any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			value, ok := node[key]
+			if !ok {
+				for k, kv := range node {
+					if strings.EqualFold(k, key) {
+						value, ok = kv, true
+						break
+					}
+				}
+			}
+			if !ok {
+				return nil, false
+			}
+			v = value
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// formatValue prints a JSON value for a table cell. Lists of values are
+// joined by commas and maps of values, such as tags, printed as key=value.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		var items []string
+		for _, item := range v {
+			if !isScalar(item) {
+				return compactJSON(v)
+			}
+			items = append(items, formatValue(item))
+		}
+		return strings.Join(items, ", ")
+	case map[string]any:
+		var items []string
+		for k, item := range v {
+			if !isScalar(item) {
+				return compactJSON(v)
+			}
+			items = append(items, k+"="+formatValue(item))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprint(v)
+}
+
+func isScalar(v any) bool {
+	switch v.(type) {
+	case map[string]any, []any:
+		return false
+	}
+	return true
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// tableRows returns the objects of a JSON list. It returns false for any
+// other result, which is printed as JSON.
+func tableRows(data []byte) ([]map[string]any, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var list []any
+	if err := decoder.Decode(&list); err != nil || len(list) == 0 {
+		return nil, false
+	}
+	rows := make([]map[string]any, 0, len(list))
+	for _, item := range list {
+		row, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		rows = append(rows, row)
+	}
+	return rows, true
+}
+
+// defaultColumns picks the columns for rows: the renderer of their resource
+// type, or else their top-level values.
+func defaultColumns(rows []map[string]any) []azColumn {
+	kind, _ := lookupPath(rows[0], "type")
+	if columns, ok := azRenderers[strings.ToLower(formatValue(kind))]; ok {
+		var used []azColumn
+		for _, col := range columns {
+			for _, row := range rows {
+				if v, ok := lookupPath(row, col.Path); ok && formatValue(v) != "" {
+					used = append(used, col)
+					break
+				}
+			}
+		}
+		return used
+	}
+
+	var fields []string
+	for _, row := range rows {
+		for k, v := range row {
+			if isScalar(v) && v != nil && !slices.Contains(fields, k) {
+				fields = append(fields, k)
+			}
+		}
+	}
+	rank := func(field string) int {
+		if i := slices.Index(azPreferredFields, field); i >= 0 {
+			return i
+		}
+		return len(azPreferredFields)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if ri, rj := rank(fields[i]), rank(fields[j]); ri != rj {
+			return ri < rj
+		}
+		return fields[i] < fields[j]
+	})
+	// IDs are long and rarely worth the space when there is anything else.
+	if len(fields) > 1 {
+		fields = slices.DeleteFunc(fields, func(f string) bool { return f == "id" })
+	}
+
+	var columns []azColumn
+	for _, f := range fields[:min(len(fields), maxAzColumns)] {
+		columns = append(columns, azColumn{Header: f, Path: f, Status: strings.EqualFold(f, "state") || strings.EqualFold(f, "provisioningState")})
+	}
+	return columns
+}
+
+// parseColumns turns -columns into columns headed by their paths.
+func parseColumns(list string) []azColumn {
+	var columns []azColumn
+	for _, path := range splitList(list) {
+		columns = append(columns, azColumn{Header: path, Path: path, Status: strings.EqualFold(path, "powerState") || strings.HasSuffix(strings.ToLower(path), "provisioningstate")})
+	}
+	return columns
+}
+
+// compareValues orders cells numerically when both are numbers.
+func compareValues(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// sortRows sorts rows by a column, given by its header or path.
+func sortRows(rows []map[string]any, columns []azColumn, by string, reverse bool) {
+	path := by
+	for _, col := range columns {
+		if strings.EqualFold(col.Header, by) || strings.EqualFold(col.Path, by) {
+			path = col.Path
+			break
+		}
+	}
+	value := func(row map[string]any) string {
+		v, _ := lookupPath(row, path)
+		return formatValue(v)
+	}
+	slices.SortStableFunc(rows, func(a, b map[string]any) int {
+		if reverse {
+			return compareValues(value(b), value(a))
+		}
+		return compareValues(value(a), value(b))
+	})
+}
+
+// statusColor colors resource states: running and succeeded in green,
+// stopped and failed in red, and transitions in yellow.
+func statusColor(value string) string {
+	v := strings.ToLower(value)
+	switch {
+	case strings.Contains(v, "running"), v == "succeeded":
+		return color.GreenString(value)
+	case strings.Contains(v, "stopped"), strings.Contains(v, "deallocated"), v == "failed":
+		return color.RedString(value)
+	case strings.HasSuffix(v, "ing"):
+		return color.YellowString(value)
+	}
+	return value
+}
+
+// printAzTable prints rows as a table of columns.
+func printAzTable(rows []map[string]any, columns []azColumn) {
+	headers := make([]interface{}, len(columns))
+	for i, col := range columns {
+		headers[i] = col.Header
+	}
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New(headers...)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWidthFunc(visibleWidth)
+	for _, row := range rows {
+		cells := make([]interface{}, len(columns))
+		for i, col := range columns {
+			v, _ := lookupPath(row, col.Path)
+			cell := formatValue(v)
+			if col.Status && i > 0 {
+				cell = statusColor(cell)
+			}
+			cells[i] = cell
+		}
+		tbl.AddRow(cells...)
+	}
+	tbl.Print()
+}
+
+// hasOutputArg reports whether az arguments choose the output format or
+// ask for help, in which case the output is passed through.
+func hasOutputArg(args []string) bool {
+	for _, a := range args {
+		switch {
+		case a == "-o", a == "--output", strings.HasPrefix(a, "--output="), strings.HasPrefix(a, "-o="):
+			return true
+		case a == "-h", a == "--help":
+			return true
+		}
+	}
+	return false
+}
+
+// readsOnly reports whether az arguments run a list, show or query command.
+// The verb is the last command word before the first flag. Positional values,
+// such as the ID in 'az resource show <id>', are not command words and are
+// skipped. Only their output is buffered for a table, since other commands
+// may ask questions, such as 'az group delete'.
+func readsOnly(args []string) bool {
+	verb := ""
+	for _, a := range args {
+		if strings.HasPrefix(a, "-") {
+			break
+		}
+		if isCommandWord(a) {
+			verb = a
+		}
+	}
+	switch {
+	case verb == "list", verb == "show", verb == "query":
+		return true
+	case strings.HasPrefix(verb, "list-"), strings.HasPrefix(verb, "show-"):
+		return true
+	}
+	return false
+}
+
+// isCommandWord reports whether s can be a word of an az command, which are
+// lowercase letters, digits and hyphens.
+func isCommandWord(s string) bool {
+	return s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyz0123456789-") == ""
+}
+
+// runAzCommand runs an Azure CLI command and prints its result as a table,
+// returning the exit code of az.
+func runAzCommand(ctx context.Context, cfg *config, args []string) (int, error) {
+	fs := flag.NewFlagSet("az", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), azUsage) }
+	columnList := fs.String("columns", "", "Comma separated columns as dotted paths")
+	sortBy := fs.String("sort", "", "Sort by a column header or path")
+	reverse := fs.Bool("reverse", false, "Reverse the order")
+	raw := fs.Bool("raw", false, "Print the JSON of az as is")
+	// az-wrap's flags end at the first az argument.
+	fs.Parse(args)
+	azArgs := fs.Args()
+	if len(azArgs) == 0 {
+		return 0, errors.New(azUsage)
+	}
+
+	ctx, _, stop := notifySignals(ctx)
+	defer stop()
+
+	passthrough := hasOutputArg(azArgs) || !readsOnly(azArgs)
+	if !passthrough {
+		azArgs = append(azArgs, "--output", "json")
+	}
+	cmd, err := cfg.azureCommand(ctx, azArgs...)
+	if err != nil {
+		return 0, err
+	}
+	var stdout bytes.Buffer
+	cmd.Stdin, cmd.Stderr = os.Stdin, os.Stderr
+	if passthrough {
+		cmd.Stdout = os.Stdout
+	} else {
+		cmd.Stdout = &stdout
+	}
+	interruptOnCancel(cmd)
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return 0, fmt.Errorf("unable to run az: %w", err)
+	}
+	code := 0
+	switch {
+	case exitErr != nil && signaled(exitErr):
+		code = 128 + int(exitErr.Sys().(syscall.WaitStatus).Signal())
+	case exitErr != nil:
+		code = max(exitErr.ExitCode(), 1)
+	}
+
+	rows, ok := tableRows(stdout.Bytes())
+	if passthrough || *raw || code != 0 || !ok {
+		os.Stdout.Write(stdout.Bytes())
+		return code, nil
+	}
+	columns := parseColumns(*columnList)
+	if len(columns) == 0 {
+		columns = defaultColumns(rows)
+	}
+	if len(columns) == 0 {
+		os.Stdout.Write(stdout.Bytes())
+		return code, nil
+	}
+	if *sortBy != "" {
+		sortRows(rows, columns, *sortBy, *reverse)
+	} else if *reverse {
+		slices.Reverse(rows)
+	}
+	printAzTable(rows, columns)
+	return code, nil
+}
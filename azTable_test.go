@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const testVMs = `[
+	{"name": "web-1", "resourceGroup": "rg-web", "location": "westeurope", "type": "Microsoft.Compute/virtualMachines",
+	 "hardwareProfile": {"vmSize": "Standard_B2s"}, "storageProfile": {"osDisk": {"osType": "Linux"}},
+	 "provisioningState": "Succeeded", "tags": {"env": "prod", "team": "web"}, "cores": 2},
+	{"name": "db-10", "resourceGroup": "rg-db", "location": "northeurope", "type": "Microsoft.Compute/virtualMachines",
+	 "hardwareProfile": {"vmSize": "Standard_D4s_v5"}, "storageProfile": {"osDisk": {"osType": "Linux"}},
+	 "provisioningState": "Succeeded", "tags": {"env": "dev"}, "cores": 16,
+	 "networkProfile": {"networkInterfaces": [{"id": "nic-1"}]}}
+]`
+
+func TestTableRows(t *testing.T) {
+	rows, ok := tableRows([]byte(testVMs))
+	if !ok || len(rows) != 2 {
+		t.Fatalf("Expected two rows, got: %v, %v", rows, ok)
+	}
+	for _, raw := range []string{`{"name": "web-1"}`, `["a", "b"]`, `[]`, `"text"`, `not json`} {
+		if _, ok := tableRows([]byte(raw)); ok {
+			t.Errorf("Expected no table for %s", raw)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"name", "db-10"},
+		{"hardwareProfile.vmSize", "Standard_D4s_v5"},
+		{"HARDWAREPROFILE.VMSIZE", "Standard_D4s_v5"},
+		{"networkProfile.networkInterfaces.0.id", "nic-1"},
+		{"networkProfile.networkInterfaces.1.id", ""},
+		{"tags", "env=dev"},
+		{"cores", "16"},
+		{"networkProfile", `{"networkInterfaces":[{"id":"nic-1"}]}`},
+	}
+	for _, test := range tests {
+		v, _ := lookupPath(rows[1], test.path)
+		if got := formatValue(v); got != test.expected {
+			t.Errorf("Expected %q for %s, got: %q", test.expected, test.path, got)
+		}
+	}
+}
+
+func TestDefaultColumns(t *testing.T) {
+	rows, _ := tableRows([]byte(testVMs))
+	var headers []string
+	for _, col := range defaultColumns(rows) {
+		headers = append(headers, col.Header)
+	}
+	// Power state and IPs are only there with 'az vm list -d'.
+	if got := strings.Join(headers, ","); got != "Name,Resource group,Location,Size,OS,State" {
+		t.Errorf("Expected the VM columns, got: %s", got)
+	}
+
+	rows, _ = tableRows([]byte(`[{"id": "/x", "zone": "1", "name": "a", "location": "westeurope", "sku": {"name": "S1"}}]`))
+	headers = nil
+	for _, col := range defaultColumns(rows) {
+		headers = append(headers, col.Header)
+	}
+	if got := strings.Join(headers, ","); got != "name,location,zone" {
+		t.Errorf("Expected the top-level values without the ID, got: %s", got)
+	}
+}
+
+func TestSortRows(t *testing.T) {
+	rows, _ := tableRows([]byte(`[{"name": "b", "n": 10}, {"name": "a", "n": 9}, {"name": "C", "n": 100}]`))
+	names := func() string {
+		var s []string
+		for _, row := range rows {
+			s = append(s, row["name"].(string))
+		}
+		return strings.Join(s, ",")
+	}
+
+	sortRows(rows, parseColumns("name,n"), "name", false)
+	if got := names(); got != "a,b,C" {
+		t.Errorf("Expected rows sorted by name, got: %s", got)
+	}
+	sortRows(rows, parseColumns("name,n"), "n", true)
+	if got := names(); got != "C,b,a" {
+		t.Errorf("Expected rows sorted by number in reverse, got: %s", got)
+	}
+}
+
+func TestAzPassthrough(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected bool
+	}{
+		{[]string{"vm", "list", "-d"}, false},
+		{[]string{"group", "show", "--name", "rg-web"}, false},
+		{[]string{"vm", "list-sizes", "-l", "westeurope"}, false},
+		{[]string{"graph", "query", "-q", "Resources"}, false},
+		{[]string{"vm", "list", "-o", "table"}, true},
+		{[]string{"vm", "list", "--output=tsv"}, true},
+		{[]string{"group", "delete", "--name", "rg-web"}, true},
+		{[]string{"vm", "create", "--name", "list"}, true},
+		{[]string{"resource", "show", "/subscriptions/x/resourceGroups/rg-web", "--api-version", "2024-01-01"}, false},
+		{[]string{"resource", "show", "https://management.azure.com/subscriptions/x"}, false},
+		{[]string{"vm", "list", "-h"}, true},
+		{[]string{"group", "show", "--help"}, true},
+		{[]string{"login"}, true},
+	}
+	for _, test := range tests {
+		if got := hasOutputArg(test.args) || !readsOnly(test.args); got != test.expected {
+			t.Errorf("Expected passthrough %v for %v, got: %v", test.expected, test.args, got)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// bindingFile binds a directory tree to a subscription.
+const bindingFile = ".az-wrap"
+
+// binding is the subscription a directory tree deploys to, with the optional
+// tenant and cloud it lives in.
+type binding struct {
+	// Subscription is the subscription ID, or an exact alias or name in a
+	// hand-written file.
+	Subscription string
+	// Alias is the alias the subscription had when it was bound, only for
+	// reading the file.
+	Alias  string
+	Tenant string
+	Cloud  string
+	// Path is the binding file the binding was read from.
+	Path string
+}
+
+// readBinding reads a binding file of key=value lines.
+func readBinding(name string) (*binding, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b := &binding{Path: name}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid line in %s: %s", name, line)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "subscription":
+			b.Subscription = value
+		case "alias":
+			b.Alias = value
+		case "tenant":
+			b.Tenant = value
+		case "cloud":
+			b.Cloud = value
+		default:
+			return nil, fmt.Errorf("unknown key '%s' in %s", key, name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", name, err)
+	}
+	if b.Subscription == "" {
+		return nil, fmt.Errorf("%s does not name a subscription", name)
+	}
+	return b, nil
+}
+
+// findBinding walks up from dir to the nearest binding file. It returns nil
+// when there is none.
+func findBinding(dir string) (*binding, error) {
+	for {
+		name := filepath.Join(dir, bindingFile)
+		if info, err := os.Stat(name); err == nil && !info.IsDir() {
+			return readBinding(name)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+func writeBinding(name string, b binding) error {
+	var sb strings.Builder
+	sb.WriteString("# Subscription this directory deploys to, see 'az-wrap hook'.\n")
+	fmt.Fprintf(&sb, "subscription=%s\n", b.Subscription)
+	if b.Alias != "" {
+		fmt.Fprintf(&sb, "alias=%s\n", b.Alias)
+	}
+	if b.Tenant != "" {
+		fmt.Fprintf(&sb, "tenant=%s\n", b.Tenant)
+	}
+	if b.Cloud != "" {
+		fmt.Fprintf(&sb, "cloud=%s\n", b.Cloud)
+	}
+	return writeFileAtomic(name, []byte(sb.String()), 0644)
+}
+
+// runBindCommand writes a binding file to the current directory. The query
+// is resolved to the subscription ID, so the binding never depends on how
+// queries match later. With -force it must be the ID.
+func runBindCommand(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("bind", flag.ExitOnError)
+	tenant := fs.String("tenant", "", "Tenant alias or ID the subscription lives in")
+	cloud := fs.String("cloud", "", "Cloud the subscription lives in")
+	force := fs.Bool("force", false, "Write the subscription ID without checking it")
+	rest := parseArgs(fs, args)
+	if len(rest) != 1 {
+		return fmt.Errorf("usage: az-wrap bind <subscription> [-tenant <tenant>] [-cloud <cloud>] [-force]")
+	}
+
+	b := binding{Subscription: rest[0], Tenant: *tenant, Cloud: *cloud}
+	if !*force {
+		aliases, err := selectableSubscriptions(cfg, options{tenant: b.Tenant, cloud: b.Cloud})
+		if err != nil {
+			return fmt.Errorf("unable to check the subscription, use -force to bind anyway: %w", err)
+		}
+		s, err := resolveSubscription(aliases, b.Subscription)
+		if err != nil {
+			return err
+		}
+		b.Subscription = s.ID
+		if s.Alias != "(no alias)" {
+			b.Alias = s.Alias
+		}
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(dir, bindingFile)
+	if err := writeBinding(name, b); err != nil {
+		return fmt.Errorf("unable to write %s: %w", name, err)
+	}
+	fmt.Printf("Bound %s to %s.\n", dir, b.Subscription)
+	return nil
+}
+
+// runCheckBindingCommand compares the active subscription with the binding of
+// the current directory, and switches to the bound one or warns about it.
+// It is run by the shell hooks and stays silent when all is well.
+func runCheckBindingCommand(ctx context.Context, cfg *config, args []string) error {
+	fs := flag.NewFlagSet("__check-binding", flag.ExitOnError)
+	switchTo := fs.Bool("switch", false, "Switch to the bound subscription instead of warning")
+	parseArgs(fs, args)
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	b, err := findBinding(dir)
+	if err != nil || b == nil {
+		return err
+	}
+
+	aliases, err := cfg.subscriptionAliases()
+	if err != nil {
+		return err
+	}
+	bound, err := filterSubscriptions(cfg, aliases, options{tenant: b.Tenant, cloud: b.Cloud})
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.Path, err)
+	}
+	// A hand-written file may name the subscription by alias or name, but
+	// never by a prefix, so it cannot drift to another subscription.
+	s, err := resolveExact(bound, b.Subscription)
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.Path, err)
+	}
+	for _, a := range aliases {
+		if a.Selected && strings.EqualFold(a.ID, s.ID) {
+			return nil
+		}
+	}
+
+	if !*switchTo {
+		color.New(color.FgYellow).Fprintf(os.Stderr, "az-wrap: %s binds this directory to %s (%s), which is not the active subscription. Run 'az-wrap use %s' to switch.\n",
+			b.Path, s.Name, s.ID, s.ID)
+		return nil
+	}
+	if err := cfg.setSubscription(ctx, s.ID, s.Cloud); err != nil {
+		return err
+	}
+	color.New(color.FgGreen).Fprintf(os.Stderr, "az-wrap: switched to %s (%s) for %s\n", s.Name, s.ID, filepath.Dir(b.Path))
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindBinding(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "infra", "modules")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatalf("Failed to create dirs: %v", err)
+	}
+
+	if b, err := findBinding(nested); err != nil || b != nil {
+		t.Fatalf("Expected no binding, got: %+v, %v", b, err)
+	}
+
+	name := filepath.Join(root, bindingFile)
+	if err := writeBinding(name, binding{Subscription: testSubA, Alias: "pay:prod", Tenant: "contoso", Cloud: "AzureUSGovernment"}); err != nil {
+		t.Fatalf("Failed to write binding: %v", err)
+	}
+	b, err := findBinding(nested)
+	if err != nil || b == nil {
+		t.Fatalf("Failed to find binding: %v", err)
+	}
+	if b.Subscription != testSubA || b.Alias != "pay:prod" || b.Tenant != "contoso" || b.Cloud != "AzureUSGovernment" || b.Path != name {
+		t.Fatalf("Binding content mismatch. Got: %+v", b)
+	}
+
+	if err := os.WriteFile(name, []byte("subscription = dev\nregion=weu\n"), 0644); err != nil {
+		t.Fatalf("Failed to write binding: %v", err)
+	}
+	if _, err := readBinding(name); err == nil {
+		t.Errorf("Expected error for an unknown key, got none")
+	}
+	if err := os.WriteFile(name, []byte("# nothing\ntenant=x\n"), 0644); err != nil {
+		t.Fatalf("Failed to write binding: %v", err)
+	}
+	if _, err := readBinding(name); err == nil {
+		t.Errorf("Expected error without a subscription, got none")
+	}
+}
+
+func TestRunBindCommand(t *testing.T) {
+	c := testConfig(t, `{"subscriptions": [
+		{"name": "payments-prod", "id": "`+testSubA+`", "isDefault": false},
+		{"name": "payments-dev", "id": "`+testSubB+`", "isDefault": true}
+	]}`)
+	if err := c.saveAliasFile(testSubA, "pay:prod"); err != nil {
+		t.Fatalf("Failed to save alias: %v", err)
+	}
+
+	wd, _ := os.Getwd()
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := runBindCommand(c, []string{"pay:prod"}); err != nil {
+		t.Fatalf("Failed to bind: %v", err)
+	}
+	b, err := readBinding(filepath.Join(dir, bindingFile))
+	if err != nil || b.Subscription != testSubA || b.Alias != "pay:prod" {
+		t.Fatalf("Expected the binding to hold the subscription ID, got: %+v, %v", b, err)
+	}
+
+	if err := runCheckBindingCommand(context.Background(), c, []string{"-switch"}); err != nil {
+		t.Fatalf("Failed to check binding: %v", err)
+	}
+	if subs, err := c.getSubscriptionsFromFile(); err != nil || !subs[0].Selected {
+		t.Fatalf("Expected payments-prod to be the default, got: %+v, %v", subs, err)
+	}
+
+	// A hand-written file may name the subscription by alias or name.
+	if err := c.saveAliasFile(testSubB, "pay:dev"); err != nil {
+		t.Fatalf("Failed to save alias: %v", err)
+	}
+	for _, value := range []string{"pay:dev", "payments-dev"} {
+		if err := writeBinding(filepath.Join(dir, bindingFile), binding{Subscription: value}); err != nil {
+			t.Fatalf("Failed to write binding: %v", err)
+		}
+		if err := runCheckBindingCommand(context.Background(), c, []string{"-switch"}); err != nil {
+			t.Fatalf("Failed to check binding to %s: %v", value, err)
+		}
+		if subs, err := c.getSubscriptionsFromFile(); err != nil || !subs[1].Selected {
+			t.Fatalf("Expected %s to switch to payments-dev, got: %+v, %v", value, subs, err)
+		}
+		if err := c.setSubscription(context.Background(), testSubA, ""); err != nil {
+			t.Fatalf("Failed to reset subscription: %v", err)
+		}
+	}
+
+	// A prefix is not resolved, the binding must not drift.
+	if err := writeBinding(filepath.Join(dir, bindingFile), binding{Subscription: "payments"}); err != nil {
+		t.Fatalf("Failed to write binding: %v", err)
+	}
+	var notFound *notFoundError
+	if err := runCheckBindingCommand(context.Background(), c, nil); !errors.As(err, &notFound) {
+		t.Errorf("Expected not found error for a prefix, got: %v", err)
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	tests := []struct{ shell, want string }{
+		{"bash", `'/it'\''s/az-wrap'`},
+		{"fish", `'/it\'s/az-wrap'`},
+		{"pwsh", `'/it''s/az-wrap'`},
+	}
+	for _, tt := range tests {
+		if got := quoteArg(tt.shell, "/it's/az-wrap"); got != tt.want {
+			t.Errorf("Expected %s for %s, got %s", tt.want, tt.shell, got)
+		}
+	}
+	for shell, script := range hookScripts {
+		if !strings.Contains(script, "%[1]s") {
+			t.Errorf("Expected the %s hook to run the check", shell)
+		}
+	}
+}
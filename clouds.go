@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultCloud is the cloud the Azure CLI uses unless told otherwise.
+const defaultCloud = "AzureCloud"
+
+// cloudARMEndpoints are the Resource Manager endpoints of the built-in
+// clouds. Custom clouds are looked up in clouds.config.
+var cloudARMEndpoints = map[string]string{
+	"azurecloud":        defaultARMEndpoint,
+	"azureusgovernment": "https://management.usgovcloudapi.net",
+	"azurechinacloud":   "https://management.chinacloudapi.cn",
+}
+
+// readINI reads the sections of an Azure CLI config file into a map of
+// section to key to value. Section names keep their case, keys are lowered.
+func readINI(name string) (map[string]map[string]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sections := map[string]map[string]string{}
+	var section map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if sections[name] == nil {
+				sections[name] = map[string]string{}
+			}
+			section = sections[name]
+		case section != nil:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			section[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return sections, scanner.Err()
+}
+
+// setINIValue returns an Azure CLI config file with a key of a section set to
+// value, adding the section or key when missing. Everything else is kept.
+func setINIValue(data []byte, section, key, value string) []byte {
+	entry := key + " = " + value
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	inSection, end := false, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			if inSection {
+				break
+			}
+			inSection = strings.TrimSpace(trimmed[1:len(trimmed)-1]) == section
+			if inSection {
+				end = i + 1
+			}
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if k, _, ok := strings.Cut(trimmed, "="); ok && strings.EqualFold(strings.TrimSpace(k), key) {
+			lines[i] = entry
+			return []byte(strings.Join(lines, "\n") + "\n")
+		}
+		if trimmed != "" {
+			end = i + 1
+		}
+	}
+	if end < 0 {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+section+"]", entry)
+	} else {
+		lines = slices.Insert(lines, end, entry)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// activeCloud returns the cloud the Azure CLI is set to, as stored by
+// 'az cloud set' in the config file of the Azure config directory.
+func (c *config) activeCloud() string {
+	ini, err := readINI(filepath.Join(c.azureDir, "config"))
+	if err != nil {
+		return defaultCloud
+	}
+	if name := ini["cloud"]["name"]; name != "" {
+		return name
+	}
+	return defaultCloud
+}
+
+// cloudARMEndpoint returns the Resource Manager endpoint of a cloud, reading
+// custom clouds from clouds.config.
+func (c *config) cloudARMEndpoint(cloud string) string {
+	if endpoint, ok := cloudARMEndpoints[strings.ToLower(cloud)]; ok {
+		return endpoint
+	}
+	if ini, err := readINI(filepath.Join(c.azureDir, "clouds.config")); err == nil {
+		if endpoint := ini[cloud]["endpoint_resource_manager"]; endpoint != "" {
+			return endpoint
+		}
+	}
+	return defaultARMEndpoint
+}
+
+// sameCloud compares cloud names, treating an unknown cloud as the default.
+func sameCloud(a, b string) bool {
+	if a == "" {
+		a = defaultCloud
+	}
+	if b == "" {
+		b = defaultCloud
+	}
+	return strings.EqualFold(a, b)
+}
+
+// filterByCloud keeps the subscriptions of a cloud.
+func filterByCloud(aliases []subscriptionAlias, cloud string) []subscriptionAlias {
+	var filtered []subscriptionAlias
+	for _, s := range aliases {
+		if sameCloud(s.Cloud, cloud) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// multipleClouds reports whether the subscriptions span more than one cloud.
+func multipleClouds(aliases []subscriptionAlias) bool {
+	for _, s := range aliases {
+		if !sameCloud(s.Cloud, aliases[0].Cloud) {
+			return true
+		}
+	}
+	return false
+}
+
+// setCloud switches the Azure CLI to another cloud.
+func (c *config) setCloud(ctx context.Context, cloud string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cmd, err := c.azureCommand(ctx, "cloud", "set", "--name", cloud)
+	if err != nil {
+		return fmt.Errorf("unable to use the Azure CLI for setting cloud: %w", err)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to set cloud %s: %w: %s", cloud, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
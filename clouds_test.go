@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testConfig returns a config that only uses temporary directories, so tests
+// never touch the files of the developer, such as the legacy alias file in
+// the home directory. Subscriptions are read from azureProfile.json, which
+// holds profile unless it is empty.
+func testConfig(t *testing.T, profile string) *config {
+	t.Helper()
+	c, err := newConfig()
+	if err != nil {
+		t.Fatalf("Failed to create new config: %v", err)
+	}
+	c.homeDir = t.TempDir()
+	c.aliasFile = filepath.Join(c.homeDir, ".azure", "aliases")
+	c.stateDir = t.TempDir()
+	c.storeFile = filepath.Join(c.stateDir, "aliases.json")
+	c.profilesFile = filepath.Join(c.stateDir, "profiles.json")
+	c.sharedStoreFiles = nil
+	c.sources = []string{"file"}
+	c.armEndpoint = ""
+	c.cacheTTL = defaultCacheTTL
+	c.setAzureDir(t.TempDir())
+	if profile != "" {
+		if err := os.WriteFile(c.azureProfile, []byte(profile), 0644); err != nil {
+			t.Fatalf("Failed to write azureProfile.json: %v", err)
+		}
+	}
+	return c
+}
+
+func TestActiveCloud(t *testing.T) {
+	c := testConfig(t, "")
+
+	if got := c.activeCloud(); got != defaultCloud {
+		t.Errorf("Expected %s without a config file, got %s", defaultCloud, got)
+	}
+
+	config := "[core]\noutput = json\n\n[cloud]\nname = AzureUSGovernment\n"
+	if err := os.WriteFile(filepath.Join(c.azureDir, "config"), []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if got := c.activeCloud(); got != "AzureUSGovernment" {
+		t.Errorf("Expected AzureUSGovernment, got %s", got)
+	}
+}
+
+func TestCloudARMEndpoint(t *testing.T) {
+	c := testConfig(t, "")
+
+	clouds := "[AzureCloud]\nsubscription = x\n\n[MyStack]\nendpoint_resource_manager = https://management.local.azurestack.external/\n"
+	if err := os.WriteFile(filepath.Join(c.azureDir, "clouds.config"), []byte(clouds), 0644); err != nil {
+		t.Fatalf("Failed to write clouds.config: %v", err)
+	}
+
+	tests := map[string]string{
+		"AzureCloud":        defaultARMEndpoint,
+		"AzureChinaCloud":   "https://management.chinacloudapi.cn",
+		"azureusgovernment": "https://management.usgovcloudapi.net",
+		"MyStack":           "https://management.local.azurestack.external/",
+		"Unknown":           defaultARMEndpoint,
+	}
+	for cloud, want := range tests {
+		if got := c.cloudARMEndpoint(cloud); got != want {
+			t.Errorf("Expected %s for %s, got %s", want, cloud, got)
+		}
+	}
+}
+
+func TestFilterByCloud(t *testing.T) {
+	aliases := []subscriptionAlias{
+		{ID: "a", Cloud: "AzureCloud"},
+		{ID: "b", Cloud: "AzureUSGovernment"},
+		{ID: "c"},
+	}
+
+	if got := filterByCloud(aliases, "azurecloud"); len(got) != 2 || got[1].ID != "c" {
+		t.Errorf("Expected a and c in AzureCloud, got %v", got)
+	}
+	if got := filterByCloud(aliases, "AzureUSGovernment"); len(got) != 1 || got[0].ID != "b" {
+		t.Errorf("Expected b in AzureUSGovernment, got %v", got)
+	}
+	if !multipleClouds(aliases) {
+		t.Errorf("Expected multiple clouds")
+	}
+	if multipleClouds(aliases[:1]) || multipleClouds(nil) {
+		t.Errorf("Expected a single cloud")
+	}
+}
+
+func TestSetINIValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "[AzureCloud]\nsubscription = sub-b\n"},
+		{"[AzureCloud]\nsubscription = sub-a\n", "[AzureCloud]\nsubscription = sub-b\n"},
+		{"[MyStack]\nsubscription = x\n", "[MyStack]\nsubscription = x\n\n[AzureCloud]\nsubscription = sub-b\n"},
+		{"[AzureCloud]\nprofile = latest\n\n[MyStack]\nsubscription = x\n", "[AzureCloud]\nprofile = latest\nsubscription = sub-b\n\n[MyStack]\nsubscription = x\n"},
+	}
+	for _, test := range tests {
+		if got := string(setINIValue([]byte(test.in), "AzureCloud", "subscription", "sub-b")); got != test.want {
+			t.Errorf("Expected %q for %q, got %q", test.want, test.in, got)
+		}
+	}
+}
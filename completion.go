@@ -0,0 +1,517 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const completionUsage = `Usage: az-wrap completion <bash|zsh|fish|powershell>
+
+Prints a completion script. Load it from your shell profile:
+
+  bash        source <(az-wrap completion bash)                          in ~/.bashrc
+  zsh         source <(az-wrap completion zsh)                           in ~/.zshrc, after compinit
+  fish        az-wrap completion fish | source                           in ~/.config/fish/config.fish
+  powershell  az-wrap completion powershell | Out-String | Invoke-Expression   in $PROFILE`
+
+// completionScripts ask 'az-wrap __complete' for candidates. %[1]s is the
+// quoted az-wrap command and %[2]s the command name to complete.
+var completionScripts = map[string]string{
+	"bash": `_az_wrap_complete() {
+  local line="${COMP_LINE:0:COMP_POINT}" cur candidate
+  local -a words quoted
+  IFS=$' \t\n' read -ra words <<< "${line}"
+  [[ "${line}" == *[[:space:]] ]] && words+=("")
+  cur="${words[${#words[@]}-1]}"
+  # Candidates are already filtered by prefix. They are read as data, since
+  # compgen -W would expand $(...) in aliases, and line by line, since
+  # mapfile needs bash 4.
+  COMPREPLY=()
+  while IFS= read -r candidate; do
+    COMPREPLY+=("${candidate}")
+  done < <(%[1]s __complete "${words[@]:1}" 2>/dev/null | cut -f1)
+  # Words are split at colons, so only complete the part after the last one.
+  if [[ "${cur}" == *:* ]]; then
+    local prefix="${cur%%%%"${cur##*:}"}"
+    COMPREPLY=("${COMPREPLY[@]#"${prefix}"}")
+  fi
+  # Subscription names may contain spaces.
+  if [[ ${#COMPREPLY[@]} -gt 0 ]]; then
+    for candidate in "${COMPREPLY[@]}"; do
+      quoted+=("$(printf '%%q' "${candidate}")")
+    done
+    COMPREPLY=("${quoted[@]}")
+  fi
+}
+complete -o default -F _az_wrap_complete %[2]s
+`,
+	"zsh": `_az_wrap() {
+  local -a candidates
+  local value desc
+  while IFS=$'\t' read -r value desc; do
+    value=${value//:/\\:}
+    if [[ -n ${desc} ]]; then
+      candidates+=("${value}:${desc}")
+    else
+      candidates+=("${value}")
+    fi
+  done < <(%[1]s __complete "${(@)words[2,CURRENT]}" 2>/dev/null)
+  _describe 'az-wrap' candidates || _files
+}
+compdef _az_wrap %[2]s
+`,
+	"fish": `function __az_wrap_complete
+    set -l tokens (commandline -opc)
+    set -l current (commandline -ct)
+    %[1]s __complete $tokens[2..-1] "$current" 2>/dev/null
+end
+complete -c %[2]s -f -a '(__az_wrap_complete)'
+`,
+	"powershell": `Register-ArgumentCompleter -Native -CommandName '%[2]s' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') { $words += '' }
+    & %[1]s __complete @words 2>$null | ForEach-Object {
+        $value, $desc = $_ -split "` + "`" + `t", 2
+        if (-not $desc) { $desc = $value }
+        [System.Management.Automation.CompletionResult]::new($value, $value, 'ParameterValue', $desc)
+    }
+}
+`,
+}
+
+// runCompletionCommand prints the completion script for a shell.
+func runCompletionCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(completionUsage)
+	}
+	shell := strings.ToLower(args[0])
+	if shell == "pwsh" {
+		shell = "powershell"
+	}
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unknown shell '%s'\n\n%s", args[0], completionUsage)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "az-wrap"
+	}
+	command := quoteArg(shell, exe)
+	if shell == "powershell" {
+		command = quoteArg("pwsh", exe)
+	}
+	fmt.Printf(script, command, "az-wrap")
+	return nil
+}
+
+// candidate is a completion with an optional description.
+type candidate struct {
+	Value       string
+	Description string
+}
+
+// commandDescriptions are the top-level commands offered for completion.
+var commandDescriptions = map[string]string{
+	"alias":      "Manage aliases",
+	"profile":    "Manage az profiles",
+	"use":        "Switch to a subscription",
+	"-":          "Switch back to the previous subscription",
+	"history":    "List recent switches",
+	"pin":        "Pin subscriptions",
+	"unpin":      "Unpin subscriptions",
+	"bind":       "Bind the current directory to a subscription",
+	"hook":       "Print the shell hook for directory bindings",
+	"shell":      "Start a shell for a subscription",
+	"completion": "Print a completion script",
+	"prompt":     "Print the active subscription for a prompt",
+	"exec":       "Run a command against a subscription",
+	"foreach":    "Run a command against many subscriptions",
+	"az":         "Run an az command and print tables",
+}
+
+// subcommands are the commands of commands, with their descriptions.
+var subcommands = map[string]map[string]string{
+	"alias": {
+		"ls": "List aliases", "check": "Audit aliases", "set": "Set the primary alias", "add": "Add an alias",
+		"rm": "Remove an alias", "mv": "Rename an alias", "edit": "Edit metadata", "export": "Export aliases",
+		"import": "Import aliases", "tenant": "Manage tenant aliases", "suggest": "Suggest aliases",
+	},
+	"alias tenant": {"ls": "List tenant aliases", "set": "Set a tenant alias", "rm": "Remove a tenant alias"},
+	"profile":      {"ls": "List az profiles", "add": "Add an az profile", "rm": "Remove an az profile"},
+	"hook":         {"bash": "", "zsh": "", "fish": "", "pwsh": ""},
+	"completion":   {"bash": "", "zsh": "", "fish": "", "powershell": ""},
+}
+
+// commandFlags are the flags of commands, and whether they take a value.
+var commandFlags = map[string]map[string]bool{
+	"alias": {
+		"tags": true, "note": true, "owner": true, "color": true, "origin": false, "format": true, "o": true,
+		"mode": true, "dry-run": false, "force": false, "rules": true, "apply": false,
+	},
+	"bind":    {"tenant": true, "cloud": true, "force": false},
+	"hook":    {"switch": false},
+	"shell":   {"env": false, "shell": true},
+	"prompt":  {"format": true, "color": true},
+	"exec":    {"isolated": false},
+	"foreach": {"j": true, "output": true, "fail-fast": false, "isolated": false},
+	"az":      {"columns": true, "sort": true, "reverse": false, "raw": false},
+}
+
+// completer computes completions. Subscriptions, tenants and profiles are
+// loaded on demand.
+type completer struct {
+	cfg *config
+	// global are the global flags and whether they take a value.
+	global map[string]bool
+}
+
+// runCompleteCommand prints the completions for the words after the program
+// name, the last being the word under the cursor. Every line is a value and an
+// optional description separated by a tab.
+func runCompleteCommand(cfg *config, words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	for _, c := range (completer{cfg, globalFlags()}).complete(words) {
+		if c.Description != "" {
+			fmt.Printf("%s\t%s\n", c.Value, c.Description)
+		} else {
+			fmt.Println(c.Value)
+		}
+	}
+}
+
+func (c completer) complete(words []string) []candidate {
+	current := words[len(words)-1]
+	words = words[:len(words)-1]
+
+	// Global flags come before the command.
+	i := 0
+	for i < len(words) && strings.HasPrefix(words[i], "-") && words[i] != "-" {
+		name := strings.TrimLeft(words[i], "-")
+		i++
+		if takesValue(c.global, name) && !strings.Contains(name, "=") {
+			if i == len(words) {
+				return filterCandidates(c.flagValues("", name, current), current)
+			}
+			if name == "profile" {
+				// Complete the subscriptions of the profile.
+				c.cfg.useProfile(words[i])
+			}
+			i++
+		}
+	}
+	if i == len(words) {
+		if strings.HasPrefix(current, "-") {
+			return filterCandidates(append(commandCandidates(), flagCandidates(c.global)...), current)
+		}
+		return filterCandidates(append(commandCandidates(), c.subscriptions()...), current)
+	}
+
+	command := words[i]
+	if _, ok := commandDescriptions[command]; !ok {
+		// A bare query takes no further arguments.
+		return nil
+	}
+	if slices.Contains(words[i:], "--") {
+		// The arguments of another command.
+		return nil
+	}
+	flags := commandFlags[command]
+
+	var positional []string
+	for j := i + 1; j < len(words); j++ {
+		name := strings.TrimLeft(words[j], "-")
+		if strings.HasPrefix(words[j], "-") && words[j] != "-" {
+			if takesValue(flags, name) && !strings.Contains(name, "=") {
+				if j == len(words)-1 {
+					return filterCandidates(c.flagValues(command, name, current), current)
+				}
+				j++
+			}
+			continue
+		}
+		positional = append(positional, words[j])
+	}
+	if strings.HasPrefix(current, "-") && current != "-" {
+		return filterCandidates(flagCandidates(flags), current)
+	}
+	return filterCandidates(c.arguments(command, positional), current)
+}
+
+// arguments returns the candidates for the next positional argument of a
+// command.
+func (c completer) arguments(command string, positional []string) []candidate {
+	n := len(positional)
+	switch command {
+	case "use", "shell", "bind", "exec":
+		if n == 0 {
+			return c.subscriptions()
+		}
+	case "pin", "unpin":
+		return c.subscriptions()
+	case "foreach":
+		if n == 0 {
+			return c.selectors()
+		}
+	case "hook", "completion":
+		if n == 0 {
+			return mapCandidates(subcommands[command])
+		}
+	case "profile":
+		switch {
+		case n == 0:
+			return mapCandidates(subcommands[command])
+		case n == 1 && positional[0] == "rm":
+			return c.profiles()
+		}
+	case "alias":
+		if n == 0 {
+			return mapCandidates(subcommands[command])
+		}
+		switch positional[0] {
+		case "set", "add", "edit":
+			if n == 1 {
+				return c.subscriptions()
+			}
+		case "rm", "mv":
+			if n == 1 {
+				return c.aliases()
+			}
+		case "tenant":
+			switch {
+			case n == 1:
+				return mapCandidates(subcommands["alias tenant"])
+			case n == 2 && (positional[1] == "set" || positional[1] == "rm"):
+				return c.tenants()
+			}
+		}
+	}
+	return nil
+}
+
+// flagValues returns the candidates for the value of a flag of a command, or
+// of a global flag when command is empty.
+func (c completer) flagValues(command, name, current string) []candidate {
+	if command == "az" {
+		// Columns are paths into the JSON of az, which only it knows.
+		return nil
+	}
+	if command == "prompt" {
+		switch name {
+		case "color":
+			return stringCandidates("ansi", "bash", "zsh", "tmux", "none")
+		case "format":
+			return stringCandidates("{alias}", "{alias}@{tenant}", "{name}", "{alias} ({cloud})")
+		}
+	}
+
+	var values []string
+	list := false
+	switch name {
+	case "columns":
+		values, list = optionalColumnNames(), true
+	case "sources":
+		values, list = []string{"file", "cli", "arm"}, true
+	case "sort":
+		values = []string{"index", "recent"}
+	case "color":
+		values = colorNames()
+	case "format":
+		values = []string{"json", "csv", "md"}
+	case "mode":
+		values = []string{"merge", "replace"}
+	case "output":
+		values = []string{"prefix", "buffered"}
+	case "shell":
+		values = []string{"sh", "fish", "pwsh"}
+	case "profile":
+		return c.profiles()
+	case "tenant":
+		return c.tenants()
+	case "cloud":
+		return c.clouds()
+	}
+
+	// Comma separated lists complete the last item.
+	prefix := ""
+	if i := strings.LastIndex(current, ","); list && i >= 0 {
+		prefix = current[:i+1]
+	}
+	var candidates []candidate
+	for _, v := range values {
+		candidates = append(candidates, candidate{Value: prefix + v})
+	}
+	return candidates
+}
+
+func (c completer) subscriptions() []candidate {
+	aliases, err := c.cfg.subscriptionAliases()
+	if err != nil {
+		return nil
+	}
+	var candidates []candidate
+	for _, s := range aliases {
+		for _, a := range s.Aliases {
+			candidates = append(candidates, candidate{Value: a, Description: s.Name})
+		}
+		candidates = append(candidates, candidate{Value: s.Name, Description: s.ID})
+		candidates = append(candidates, candidate{Value: s.ID, Description: s.Name})
+	}
+	return candidates
+}
+
+// selectors returns the foreach selectors: tags, tenants and subscriptions.
+func (c completer) selectors() []candidate {
+	aliases, err := c.cfg.subscriptionAliases()
+	if err != nil {
+		return nil
+	}
+	var candidates []candidate
+	seen := map[string]bool{}
+	for _, s := range aliases {
+		for _, tag := range s.Tags {
+			if !seen[strings.ToLower(tag)] {
+				seen[strings.ToLower(tag)] = true
+				candidates = append(candidates, candidate{Value: "tag:" + tag})
+			}
+		}
+	}
+	for _, t := range c.tenants() {
+		candidates = append(candidates, candidate{Value: "tenant:" + t.Value, Description: t.Description})
+	}
+	return append(candidates, c.subscriptions()...)
+}
+
+func (c completer) aliases() []candidate {
+	store, err := c.cfg.loadMergedAliasStore()
+	if err != nil {
+		return nil
+	}
+	var candidates []candidate
+	for _, id := range store.ids() {
+		for _, a := range store.Subscriptions[id].Aliases {
+			candidates = append(candidates, candidate{Value: a, Description: id})
+		}
+	}
+	return candidates
+}
+
+func (c completer) tenants() []candidate {
+	aliases, err := c.cfg.subscriptionAliases()
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var candidates []candidate
+	for _, s := range aliases {
+		if s.TenantID == "" || seen[s.TenantID] {
+			continue
+		}
+		seen[s.TenantID] = true
+		if s.TenantAlias != "" {
+			candidates = append(candidates, candidate{Value: s.TenantAlias, Description: s.TenantID})
+		}
+		candidates = append(candidates, candidate{Value: s.TenantID, Description: s.TenantAlias})
+	}
+	return candidates
+}
+
+func (c completer) clouds() []candidate {
+	names := []string{defaultCloud, "AzureUSGovernment", "AzureChinaCloud"}
+	if aliases, err := c.cfg.subscriptionAliases(); err == nil {
+		for _, s := range aliases {
+			if s.Cloud != "" && !containsFold(names, s.Cloud) {
+				names = append(names, s.Cloud)
+			}
+		}
+	}
+	var candidates []candidate
+	for _, name := range names {
+		candidates = append(candidates, candidate{Value: name})
+	}
+	return candidates
+}
+
+func (c completer) profiles() []candidate {
+	profiles, err := c.cfg.loadProfiles()
+	if err != nil {
+		return nil
+	}
+	var candidates []candidate
+	for name, dir := range profiles {
+		candidates = append(candidates, candidate{Value: name, Description: dir})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Value < candidates[j].Value })
+	return candidates
+}
+
+// globalFlags returns the global flags and whether they take a value.
+func globalFlags() map[string]bool {
+	flags := map[string]bool{}
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags[f.Name] = !ok || !b.IsBoolFlag()
+	})
+	return flags
+}
+
+func takesValue(flags map[string]bool, name string) bool {
+	return flags[name]
+}
+
+func flagCandidates(flags map[string]bool) []candidate {
+	var candidates []candidate
+	for name := range flags {
+		candidates = append(candidates, candidate{Value: "-" + name})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Value < candidates[j].Value })
+	return candidates
+}
+
+func commandCandidates() []candidate {
+	return mapCandidates(commandDescriptions)
+}
+
+func stringCandidates(values ...string) []candidate {
+	var candidates []candidate
+	for _, v := range values {
+		candidates = append(candidates, candidate{Value: v})
+	}
+	return candidates
+}
+
+func mapCandidates(m map[string]string) []candidate {
+	var candidates []candidate
+	for value, desc := range m {
+		candidates = append(candidates, candidate{Value: value, Description: desc})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Value < candidates[j].Value })
+	return candidates
+}
+
+// filterCandidates keeps the candidates starting with prefix, ignoring case.
+func filterCandidates(candidates []candidate, prefix string) []candidate {
+	var filtered []candidate
+	for _, c := range candidates {
+		if strings.HasPrefix(strings.ToLower(c.Value), strings.ToLower(prefix)) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	c := testConfig(t, `{"subscriptions": [
+		{"name": "payments-prod", "id": "`+testSubA+`", "isDefault": true},
+		{"name": "payments-dev", "id": "`+testSubB+`", "isDefault": false}
+	]}`)
+	if err := c.saveAliasFile(testSubA, "pay:prod"); err != nil {
+		t.Fatalf("Failed to save alias: %v", err)
+	}
+
+	global := map[string]bool{"plain": false, "sort": true, "sources": true}
+	values := func(words ...string) []string {
+		var v []string
+		for _, c := range (completer{c, global}).complete(words) {
+			v = append(v, c.Value)
+		}
+		return v
+	}
+	tests := []struct {
+		words    []string
+		expected []string
+	}{
+		{[]string{"al"}, []string{"alias"}},
+		{[]string{"pay:"}, []string{"pay:prod"}},
+		{[]string{"use", "payments-d"}, []string{"payments-dev"}},
+		{[]string{"use", testSubB[:4]}, []string{testSubB}},
+		{[]string{"-plain", "use", "PAY:"}, []string{"pay:prod"}},
+		{[]string{"alias", "t"}, []string{"tenant"}},
+		{[]string{"alias", "rm", ""}, []string{"pay:prod"}},
+		{[]string{"alias", "-color", "gr"}, []string{"green"}},
+		{[]string{"-sort", ""}, []string{"index", "recent"}},
+		{[]string{"az", "-sort", ""}, nil},
+		{[]string{"az", "-columns", ""}, nil},
+		{[]string{"-sources", "file,c"}, []string{"file,cli"}},
+		{[]string{"hook", "-sw"}, []string{"-switch"}},
+		{[]string{"completion", "p"}, []string{"powershell"}},
+		{[]string{"payments", ""}, nil},
+	}
+	for _, test := range tests {
+		got := values(test.words...)
+		if len(got) != len(test.expected) {
+			t.Errorf("Expected %v for %q, got: %v", test.expected, test.words, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("Expected %v for %q, got: %v", test.expected, test.words, got)
+				break
+			}
+		}
+	}
+}
+
+func TestBashCompletionQuoting(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("needs bash")
+	}
+	marker := filepath.Join(t.TempDir(), "expanded")
+
+	// A stub prints a hostile alias as the only candidate.
+	stub := "az_wrap_stub() { printf '%s\\tsubscription\\n' 'x$(touch " + marker + ")'; }\n"
+	script := stub + fmt.Sprintf(completionScripts["bash"], "az_wrap_stub", "az-wrap") + `
+COMP_LINE="az-wrap use x" COMP_POINT=13
+_az_wrap_complete
+printf '%s\n' "${COMPREPLY[@]}"
+`
+	out, err := exec.Command(bash, "-c", script).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run the bash completion: %v\n%s", err, out)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatalf("Expected the candidate not to be expanded")
+	}
+	if got := strings.TrimSpace(string(out)); got != `x\$\(touch\ `+marker+`\)` {
+		t.Errorf("Expected the candidate to be quoted, got: %s", got)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const execUsage = `Usage: az-wrap exec [-isolated] <subscription> -- <command> [arguments]
+
+Runs a command against a subscription without changing the default one.
+AZURE_SUBSCRIPTION_ID, ARM_SUBSCRIPTION_ID and ARM_TENANT_ID are set for the
+command, and az commands get --subscription. With -isolated the command also
+gets a private copy of the Azure config directory, see 'az-wrap shell'.`
+
+// azWithoutSubscription are the az commands that do not accept --subscription,
+// as the leading words of the command. They work on the tenant, such as ad,
+// on local tools and settings, or select the subscription themselves.
+var azWithoutSubscription = []string{
+	"account clear", "account list", "account management-group", "account set",
+	"account tenant", "ad", "bicep", "cloud", "config", "configure", "devops",
+	"extension", "feedback", "find", "init", "interactive", "login", "logout",
+	"rest", "self-test", "survey", "upgrade", "version",
+}
+
+// exitInterrupted is the exit code of a command stopped by Ctrl-C, as a shell
+// would report it.
+const exitInterrupted = 130
+
+// subscriptionEnv returns the variables that point tools such as Terraform and
+// the Azure SDKs at a subscription.
+func subscriptionEnv(s subscriptionAlias) []string {
+	env := []string{"AZURE_SUBSCRIPTION_ID=" + s.ID, "ARM_SUBSCRIPTION_ID=" + s.ID}
+	if s.TenantID != "" {
+		env = append(env, "ARM_TENANT_ID="+s.TenantID)
+	}
+	return env
+}
+
+// isAzureCLI reports whether a command is the Azure CLI.
+func isAzureCLI(command string) bool {
+	name := strings.ToLower(filepath.Base(command))
+	for _, ext := range []string{".exe", ".cmd", ".bat"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name == "az"
+}
+
+// withSubscriptionArg adds --subscription to the arguments of an az command,
+// unless they already name one or the command does not accept it.
+func withSubscriptionArg(args []string, subscriptionId string) []string {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return args
+	}
+	for _, command := range azWithoutSubscription {
+		words := strings.Fields(command)
+		if len(args) >= len(words) && slices.Equal(args[:len(words)], words) {
+			return args
+		}
+	}
+	for _, a := range args {
+		if a == "--subscription" || a == "-s" || strings.HasPrefix(a, "--subscription=") || strings.HasPrefix(a, "-s=") {
+			return args
+		}
+	}
+	return append(slices.Clone(args), "--subscription", subscriptionId)
+}
+
+// splitCommand splits the arguments of exec at "--".
+func splitCommand(args []string) ([]string, []string, bool) {
+	i := slices.Index(args, "--")
+	if i < 0 || i == len(args)-1 {
+		return nil, nil, false
+	}
+	return args[:i], args[i+1:], true
+}
+
+// interruptOnCancel gives a command started with exec.CommandContext a chance
+// to clean up before it is killed when the context is cancelled.
+func interruptOnCancel(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 10 * time.Second
+}
+
+// notifySignals keeps Ctrl-C from stopping az-wrap while commands run. The
+// terminal sends Ctrl-C to the commands as well, so it is not passed on, and
+// the commands report how they ended. The second context is done after
+// Ctrl-C, so no further commands are started. SIGTERM only reaches az-wrap,
+// so it cancels the first context, which interrupts the commands.
+func notifySignals(ctx context.Context) (context.Context, context.Context, func()) {
+	ctx, stopTerm := signal.NotifyContext(ctx, syscall.SIGTERM)
+	interrupted, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-interrupted.Done():
+		}
+	}()
+	return ctx, interrupted, func() {
+		signal.Stop(signals)
+		cancel()
+		stopTerm()
+	}
+}
+
+// runChild runs a command for a subscription and returns its exit code. The
+// command uses azureDir as its Azure config directory, which is a private
+// copy when session is set. It is interrupted when ctx is cancelled.
+func runChild(ctx context.Context, s subscriptionAlias, azureDir string, session bool, command []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	args := command[1:]
+	if isAzureCLI(command[0]) {
+		args = withSubscriptionArg(args, s.ID)
+	}
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	cmd.Env = append(os.Environ(), subscriptionEnv(s)...)
+	// Like azureCommand, so -profile and AZURE_CONFIG_DIR reach the command.
+	cmd.Env = append(cmd.Env, "AZURE_CONFIG_DIR="+azureDir)
+	if session {
+		cmd.Env = append(cmd.Env, "AZ_WRAP_SESSION="+sessionLabel(s))
+	}
+	interruptOnCancel(cmd)
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		return exitErr.ExitCode(), nil
+	case exitErr != nil && signaled(exitErr):
+		// Report the signal as a shell would, 130 for Ctrl-C.
+		return 128 + int(exitErr.Sys().(syscall.WaitStatus).Signal()), nil
+	case ctx.Err() != nil:
+		return exitInterrupted, nil
+	case exitErr != nil:
+		return 1, nil
+	}
+	return 0, fmt.Errorf("unable to run %s: %w", command[0], err)
+}
+
+// signaled reports whether a command was killed by a signal.
+func signaled(exitErr *exec.ExitError) bool {
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled()
+}
+
+// runExecCommand runs a command against a subscription and returns the exit
+// code of the command.
+func runExecCommand(ctx context.Context, cfg *config, opts options, args []string) (int, error) {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), execUsage) }
+	isolated := fs.Bool("isolated", false, "Give the command a private copy of the Azure config directory")
+	own, command, ok := splitCommand(args)
+	if !ok {
+		return 0, errors.New(execUsage)
+	}
+	rest := parseArgs(fs, own)
+	if len(rest) != 1 {
+		return 0, errors.New(execUsage)
+	}
+
+	aliases, err := selectableSubscriptions(cfg, opts)
+	if err != nil {
+		return 0, err
+	}
+	s, err := resolveSubscription(aliases, rest[0])
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, _, stop := notifySignals(ctx)
+	defer stop()
+
+	azureDir := cfg.azureDir
+	if *isolated {
+		dir, err := cfg.tempSession(ctx, s)
+		if err != nil {
+			return 0, err
+		}
+		defer os.RemoveAll(dir)
+		azureDir = dir
+	}
+
+	return runChild(ctx, s, azureDir, *isolated, command, os.Stdin, os.Stdout, os.Stderr)
+}
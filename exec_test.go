@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithSubscriptionArg(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"vm", "list"}, []string{"vm", "list", "--subscription", testSubA}},
+		{[]string{"vm", "list", "--subscription", testSubB}, []string{"vm", "list", "--subscription", testSubB}},
+		{[]string{"vm", "list", "--subscription=" + testSubB}, []string{"vm", "list", "--subscription=" + testSubB}},
+		{[]string{"vm", "list", "-s", testSubB}, []string{"vm", "list", "-s", testSubB}},
+		{[]string{"vm", "list", "-s=" + testSubB}, []string{"vm", "list", "-s=" + testSubB}},
+		{[]string{"account", "show"}, []string{"account", "show", "--subscription", testSubA}},
+		{[]string{"account", "list"}, []string{"account", "list"}},
+		{[]string{"ad", "signed-in-user", "show"}, []string{"ad", "signed-in-user", "show"}},
+		{[]string{"bicep", "build", "-f", "main.bicep"}, []string{"bicep", "build", "-f", "main.bicep"}},
+		{[]string{"--version"}, []string{"--version"}},
+		{[]string{"login"}, []string{"login"}},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		if got := withSubscriptionArg(test.args, testSubA); !slices.Equal(got, test.expected) {
+			t.Errorf("Expected %v for %v, got: %v", test.expected, test.args, got)
+		}
+	}
+
+	for command, expected := range map[string]bool{"az": true, "/usr/bin/az": true, `C:\Azure\az.cmd`: runtime.GOOS == "windows", "terraform": false, "azcopy": false} {
+		if got := isAzureCLI(command); got != expected {
+			t.Errorf("Expected %v for %s, got: %v", expected, command, got)
+		}
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	own, command, ok := splitCommand([]string{"-isolated", "prod", "--", "terraform", "plan", "--", "x"})
+	if !ok || !slices.Equal(own, []string{"-isolated", "prod"}) || !slices.Equal(command, []string{"terraform", "plan", "--", "x"}) {
+		t.Errorf("Expected a split at the first --, got: %v, %v, %v", own, command, ok)
+	}
+	if _, _, ok := splitCommand([]string{"prod", "terraform"}); ok {
+		t.Errorf("Expected no command without --")
+	}
+	if _, _, ok := splitCommand([]string{"prod", "--"}); ok {
+		t.Errorf("Expected no command after a trailing --")
+	}
+}
+
+func TestRunChild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	s := subscriptionAlias{Name: "payments-dev", ID: testSubB, TenantID: "tenant-id", Aliases: []string{"pay:dev"}}
+	script := `echo "$AZURE_SUBSCRIPTION_ID $ARM_SUBSCRIPTION_ID $ARM_TENANT_ID $AZ_WRAP_SESSION"; exit 7`
+
+	var stdout bytes.Buffer
+	code, err := runChild(context.Background(), s, "/tmp/session", true, []string{"sh", "-c", script}, nil, &stdout, os.Stderr)
+	if err != nil {
+		t.Fatalf("Failed to run command: %v", err)
+	}
+	if code != 7 {
+		t.Errorf("Expected exit code 7, got: %d", code)
+	}
+	if got, expected := strings.TrimSpace(stdout.String()), testSubB+" "+testSubB+" tenant-id pay:dev"; got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+
+	if _, err := runChild(context.Background(), s, "/tmp/azure", false, []string{filepath.Join(t.TempDir(), "missing")}, nil, &stdout, os.Stderr); err == nil {
+		t.Errorf("Expected error for a missing command, got none")
+	}
+
+	// A command killed by Ctrl-C reports it like a shell.
+	code, err = runChild(context.Background(), s, "/tmp/azure", false, []string{"sh", "-c", "kill -INT $$"}, nil, &stdout, os.Stderr)
+	if err != nil || code != exitInterrupted {
+		t.Errorf("Expected exit code %d, got: %d, %v", exitInterrupted, code, err)
+	}
+}
+
+func TestRunExecCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	c := testConfig(t, `{"subscriptions": [
+		{"name": "payments-prod", "id": "`+testSubA+`", "isDefault": true},
+		{"name": "payments-dev", "id": "`+testSubB+`", "isDefault": false}
+	]}`)
+	ctx := context.Background()
+
+	check := `test "$ARM_SUBSCRIPTION_ID" = ` + testSubB + ` && test "$AZURE_CONFIG_DIR" != ` + c.azureDir
+	code, err := runExecCommand(ctx, c, options{}, []string{"-isolated", "pay-dev", "--", "sh", "-c", check})
+	if err != nil || code != 0 {
+		t.Fatalf("Failed to run isolated command: %d, %v", code, err)
+	}
+	subs, err := c.getSubscriptionsFromFile()
+	if err != nil || !subs[0].Selected || subs[1].Selected {
+		t.Fatalf("Expected the default subscription to stay unchanged, got: %+v, %v", subs, err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(c.stateDir, "sessions"))
+	if len(entries) != 0 {
+		t.Errorf("Expected the session directory to be removed, got: %v", entries)
+	}
+
+	if code, err := runExecCommand(ctx, c, options{}, []string{"pay-dev", "--", "sh", "-c", "exit 3"}); err != nil || code != 3 {
+		t.Errorf("Expected exit code 3, got: %d, %v", code, err)
+	}
+
+	// Without -isolated the command uses the Azure config directory of
+	// az-wrap, such as that of -profile.
+	check = `test "$AZURE_CONFIG_DIR" = ` + c.azureDir + ` && test -z "$AZ_WRAP_SESSION"`
+	if code, err := runExecCommand(ctx, c, options{}, []string{"pay-dev", "--", "sh", "-c", check}); err != nil || code != 0 {
+		t.Errorf("Expected the Azure config directory to be passed on, got: %d, %v", code, err)
+	}
+
+	// Ctrl-C reaches the command from the terminal. az-wrap neither stops
+	// nor interrupts it again, and reports how the command ended.
+	trap := `trap 'exit 0' INT; kill -INT $PPID; sleep 1; exit 4`
+	if code, err := runExecCommand(ctx, c, options{}, []string{"pay-dev", "--", "sh", "-c", trap}); err != nil || code != 4 {
+		t.Errorf("Expected the command to finish after Ctrl-C of az-wrap, got: %d, %v", code, err)
+	}
+	if _, err := runExecCommand(ctx, c, options{}, []string{"pay-dev", "sh"}); err == nil {
+		t.Errorf("Expected usage error without --, got none")
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+const foreachUsage = `Usage: az-wrap foreach [flags] <selector> -- <command> [arguments]
+
+Runs a command against every subscription the selector matches, see
+'az-wrap exec'. The selector is a comma separated list of:
+
+  tag:<tag>        Subscriptions with the tag
+  tenant:<tenant>  Subscriptions of the tenant alias or ID
+  <glob>           Aliases or names matching a pattern such as '*-prod'
+  <subscription>   A single subscription by its exact index, alias, name or ID
+
+Flags:
+  -j <n>              Run at most n commands at a time (default 4)
+  -output <mode>      prefix: prefix every line with the subscription (default)
+                      buffered: print the output of each command in one block
+  -fail-fast          Stop all commands after the first failure
+  -isolated           Give every command a private copy of the Azure config directory`
+
+// foreachResult is the outcome of the command for one subscription.
+type foreachResult struct {
+	Subscription subscriptionAlias
+	Code         int
+	Err          error
+	Duration     time.Duration
+	// Skipped is set when the command never ran because of -fail-fast or
+	// Ctrl-C.
+	Skipped bool
+}
+
+func (r foreachResult) failed() bool {
+	return r.Err != nil || r.Code != 0
+}
+
+// selectSubscriptions returns the subscriptions matching a foreach selector,
+// in the order of the listing.
+func (c *config) selectSubscriptions(aliases []subscriptionAlias, selector string) ([]subscriptionAlias, error) {
+	selected := make(map[string]bool)
+	for _, term := range splitList(selector) {
+		var matches []subscriptionAlias
+		switch {
+		case strings.HasPrefix(strings.ToLower(term), "tag:"):
+			tag := term[len("tag:"):]
+			for _, s := range aliases {
+				if containsFold(s.Tags, tag) {
+					matches = append(matches, s)
+				}
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no subscriptions are tagged '%s'", tag)
+			}
+		case strings.HasPrefix(strings.ToLower(term), "tenant:"):
+			tenant, err := c.tenantSubscriptions(aliases, term[len("tenant:"):])
+			if err != nil {
+				return nil, err
+			}
+			matches = tenant
+		case strings.ContainsAny(term, "*?["):
+			pattern := strings.ToLower(term)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %w", term, err)
+			}
+			for _, s := range aliases {
+				for _, text := range append([]string{s.Name}, s.Aliases...) {
+					if ok, _ := path.Match(pattern, strings.ToLower(text)); ok {
+						matches = append(matches, s)
+						break
+					}
+				}
+			}
+			if len(matches) == 0 {
+				return nil, &notFoundError{Query: term}
+			}
+		default:
+			// Loose matching could quietly add the wrong subscription.
+			s, err := resolveExact(aliases, term)
+			if err != nil {
+				return nil, err
+			}
+			matches = []subscriptionAlias{s}
+		}
+		for _, s := range matches {
+			selected[strings.ToLower(s.ID)] = true
+		}
+	}
+
+	var result []subscriptionAlias
+	for _, s := range aliases {
+		if selected[strings.ToLower(s.ID)] {
+			result = append(result, s)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("the selector '%s' matches no subscriptions", selector)
+	}
+	return result, nil
+}
+
+// prefixWriter writes whole lines to w, each starting with prefix. Writers
+// sharing mu never mix their lines.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		p.mu.Lock()
+		_, err := fmt.Fprintf(p.w, "%s%s", p.prefix, p.buf[:i+1])
+		p.mu.Unlock()
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Flush writes a last line without a newline.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.Write([]byte("\n"))
+	}
+}
+
+// foreachLabel is the prefix of the output of a subscription, in the color
+// of its alias.
+func foreachLabel(s subscriptionAlias, width int) string {
+	label := fmt.Sprintf("%-*s", width, sessionLabel(s))
+	if attr, ok := aliasColors[s.Color]; ok {
+		return color.New(attr).Sprint(label)
+	}
+	return label
+}
+
+// runForeach runs the command for every subscription, at most jobs at a
+// time, and returns the results in the order of subs. Commands are
+// interrupted when ctx is cancelled, and no more are started once interrupted
+// is done.
+func runForeach(ctx, interrupted context.Context, cfg *config, subs []subscriptionAlias, command []string, jobs int, buffered, failFast, isolated bool, stdout, stderr io.Writer) []foreachResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	width := 0
+	for _, s := range subs {
+		width = max(width, len(sessionLabel(s)))
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make([]foreachResult, len(subs))
+	slots := make(chan struct{}, jobs)
+	for i, s := range subs {
+		results[i] = foreachResult{Subscription: s, Skipped: true}
+		slots <- struct{}{}
+		if ctx.Err() != nil || interrupted.Err() != nil {
+			<-slots
+			continue
+		}
+		wg.Add(1)
+		go func(i int, s subscriptionAlias) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			var out, errOut io.Writer
+			var block bytes.Buffer
+			var prefixed []*prefixWriter
+			if buffered {
+				out, errOut = &block, &block
+			} else {
+				label := foreachLabel(s, width) + " | "
+				o := &prefixWriter{mu: &mu, w: stdout, prefix: label}
+				e := &prefixWriter{mu: &mu, w: stderr, prefix: label}
+				out, errOut, prefixed = o, e, []*prefixWriter{o, e}
+			}
+
+			start := time.Now()
+			r := foreachResult{Subscription: s}
+			azureDir := cfg.azureDir
+			if isolated {
+				dir, err := cfg.tempSession(ctx, s)
+				if err == nil {
+					defer os.RemoveAll(dir)
+				}
+				azureDir, r.Err = dir, err
+			}
+			if r.Err == nil {
+				r.Code, r.Err = runChild(ctx, s, azureDir, isolated, command, nil, out, errOut)
+			}
+			r.Duration = time.Since(start)
+			if r.Err != nil {
+				fmt.Fprintln(errOut, r.Err)
+			}
+
+			for _, p := range prefixed {
+				p.Flush()
+			}
+			if buffered {
+				mu.Lock()
+				color.New(color.FgGreen, color.Underline).Fprintf(stdout, "%s (%s)", s.Name, s.ID)
+				fmt.Fprintf(stdout, "\n%s\n", block.Bytes())
+				mu.Unlock()
+			}
+			if failFast && r.failed() {
+				cancel()
+			}
+			results[i] = r
+		}(i, s)
+	}
+	wg.Wait()
+	return results
+}
+
+// printForeachSummary prints the exit code and duration of every command.
+func printForeachSummary(w io.Writer, results []foreachResult) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	tbl := table.New("Subscription", "Name", "Exit code", "Duration").WithWriter(w)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, r := range results {
+		code, duration := strconv.Itoa(r.Code), r.Duration.Round(time.Millisecond).String()
+		switch {
+		case r.Skipped:
+			code, duration = "skipped", "-"
+		case r.Err != nil:
+			code = "error"
+		}
+		tbl.AddRow(sessionLabel(r.Subscription), r.Subscription.Name, code, duration)
+	}
+	tbl.Print()
+}
+
+// runForeachCommand runs a command against the subscriptions a selector
+// matches. It returns 1 when any command failed or was skipped.
+func runForeachCommand(ctx context.Context, cfg *config, opts options, args []string) (int, error) {
+	fs := flag.NewFlagSet("foreach", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), foreachUsage) }
+	jobs := fs.Int("j", 4, "Run at most this many commands at a time")
+	output := fs.String("output", "prefix", "Output mode: prefix or buffered")
+	failFast := fs.Bool("fail-fast", false, "Stop all commands after the first failure")
+	isolated := fs.Bool("isolated", false, "Give every command a private copy of the Azure config directory")
+	own, command, ok := splitCommand(args)
+	if !ok {
+		return 0, errors.New(foreachUsage)
+	}
+	rest := parseArgs(fs, own)
+	if len(rest) != 1 {
+		return 0, errors.New(foreachUsage)
+	}
+	if *jobs < 1 {
+		return 0, fmt.Errorf("-j must be at least 1")
+	}
+	if *output != "prefix" && *output != "buffered" {
+		return 0, fmt.Errorf("unknown output mode '%s', use prefix or buffered", *output)
+	}
+
+	aliases, err := selectableSubscriptions(cfg, opts)
+	if err != nil {
+		return 0, err
+	}
+	subs, err := cfg.selectSubscriptions(aliases, rest[0])
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, interrupted, stop := notifySignals(ctx)
+	defer stop()
+	results := runForeach(ctx, interrupted, cfg, subs, command, *jobs, *output == "buffered", *failFast, *isolated, os.Stdout, os.Stderr)
+
+	fmt.Fprintln(os.Stderr)
+	printForeachSummary(os.Stderr, results)
+	for _, r := range results {
+		if r.failed() || r.Skipped {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
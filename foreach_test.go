@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSelectSubscriptions(t *testing.T) {
+	c := testConfig(t, "")
+	aliases := []subscriptionAlias{
+		{Name: "payments-prod", ID: testSubA, Aliases: []string{"pay:prod"}, Tags: []string{"prod"}},
+		{Name: "payments-dev", ID: testSubB, Aliases: []string{"pay:dev"}},
+		{Name: "identity-prod", ID: testSubC, Tags: []string{"Prod", "identity"}},
+	}
+	ids := func(subs []subscriptionAlias) string {
+		var s []string
+		for _, a := range subs {
+			s = append(s, a.ID)
+		}
+		return strings.Join(s, ",")
+	}
+
+	tests := []struct {
+		selector string
+		expected string
+	}{
+		{"tag:prod", testSubA + "," + testSubC},
+		{"*-prod", testSubA + "," + testSubC},
+		{"PAY:*", testSubA + "," + testSubB},
+		{"identity-prod,pay:dev", testSubB + "," + testSubC},
+		{"tag:identity,identity-prod", testSubC},
+	}
+	for _, test := range tests {
+		subs, err := c.selectSubscriptions(aliases, test.selector)
+		if err != nil {
+			t.Errorf("Failed to select %s: %v", test.selector, err)
+			continue
+		}
+		if got := ids(subs); got != test.expected {
+			t.Errorf("Expected %s for %s, got: %s", test.expected, test.selector, got)
+		}
+	}
+
+	var notFound *notFoundError
+	if _, err := c.selectSubscriptions(aliases, "*-staging"); !errors.As(err, &notFound) {
+		t.Errorf("Expected not found error, got: %v", err)
+	}
+	if _, err := c.selectSubscriptions(aliases, "identity"); !errors.As(err, &notFound) {
+		t.Errorf("Expected not found error for a loose match, got: %v", err)
+	}
+	if _, err := c.selectSubscriptions(aliases, "tag:staging"); err == nil {
+		t.Errorf("Expected error for an unknown tag, got none")
+	}
+	if _, err := c.selectSubscriptions(aliases, "[pay"); err == nil {
+		t.Errorf("Expected error for an invalid pattern, got none")
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	p := &prefixWriter{mu: &sync.Mutex{}, w: &out, prefix: "a | "}
+	p.Write([]byte("one\ntw"))
+	p.Write([]byte("o\nthree"))
+	p.Flush()
+	if expected := "a | one\na | two\na | three\n"; out.String() != expected {
+		t.Errorf("Expected %q, got: %q", expected, out.String())
+	}
+}
+
+func TestRunForeach(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	c := testConfig(t, "")
+	subs := []subscriptionAlias{
+		{Name: "payments-prod", ID: testSubA, Aliases: []string{"prod"}},
+		{Name: "payments-dev", ID: testSubB, Aliases: []string{"dev"}},
+		{Name: "identity-prod", ID: testSubC},
+	}
+	command := []string{"sh", "-c", `echo "$ARM_SUBSCRIPTION_ID"; test "$ARM_SUBSCRIPTION_ID" != ` + testSubB}
+
+	var stdout, stderr bytes.Buffer
+	results := runForeach(context.Background(), context.Background(), c, subs, command, 2, false, false, false, &stdout, &stderr)
+	for i, expected := range []int{0, 1, 0} {
+		if results[i].Code != expected || results[i].Skipped || results[i].Err != nil {
+			t.Errorf("Expected exit code %d for %s, got: %+v", expected, subs[i].Name, results[i])
+		}
+	}
+	for _, line := range []string{"prod          | " + testSubA, "dev           | " + testSubB, "identity-prod | " + testSubC} {
+		if !strings.Contains(stdout.String(), line+"\n") {
+			t.Errorf("Expected output line %q, got: %q", line, stdout.String())
+		}
+	}
+
+	stdout.Reset()
+	results = runForeach(context.Background(), context.Background(), c, subs[1:], command, 1, true, true, false, &stdout, &stderr)
+	if results[0].Code != 1 || !results[1].Skipped {
+		t.Errorf("Expected the second command to be skipped, got: %+v", results)
+	}
+	if !strings.Contains(stdout.String(), "payments-dev ("+testSubB+")") || strings.Contains(stdout.String(), testSubC) {
+		t.Errorf("Expected one output block, got: %q", stdout.String())
+	}
+
+	// After Ctrl-C no more commands are started.
+	interrupted, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = runForeach(context.Background(), interrupted, c, subs, command, 1, false, false, false, &stdout, &stderr)
+	for _, r := range results {
+		if !r.Skipped {
+			t.Errorf("Expected every command to be skipped after Ctrl-C, got: %+v", r)
+		}
+	}
+}
@@ -4,11 +4,9 @@ go 1.22
 
 require (
 	github.com/fatih/color v1.17.0
+	github.com/mattn/go-isatty v0.0.20
 	github.com/rodaine/table v1.2.0
+	golang.org/x/sys v0.18.0
 )
 
-require (
-	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.20 // indirect
-	golang.org/x/sys v0.18.0 // indirect
-)
+require github.com/mattn/go-colorable v0.1.13 // indirect
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+// maxHistory is the number of switches kept in the history file.
+const maxHistory = 100
+
+// historyEntry is one successful subscription switch.
+type historyEntry struct {
+	ID string `json:"id"`
+	// Previous is the subscription that was the default before the switch.
+	Previous string    `json:"previous,omitempty"`
+	Time     time.Time `json:"time"`
+	AzureDir string    `json:"azureDir"`
+}
+
+func (c *config) historyFile() string {
+	return filepath.Join(c.stateDir, "history.json")
+}
+
+// loadHistory reads the switches made in the active Azure config directory,
+// most recent first.
+func (c *config) loadHistory() ([]historyEntry, error) {
+	all, err := c.loadAllHistory()
+	if err != nil {
+		return nil, err
+	}
+	var entries []historyEntry
+	for _, e := range all {
+		if e.AzureDir == c.azureDir {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (c *config) loadAllHistory() ([]historyEntry, error) {
+	data, err := os.ReadFile(c.historyFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history: %w", err)
+	}
+	var entries []historyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("unable to parse history: %w", err)
+	}
+	return entries, nil
+}
+
+// recordSwitch adds a switch to the history. The switch already happened, so
+// a history that cannot be written is ignored.
+func (c *config) recordSwitch(ID, previous string) {
+	entries, err := c.loadAllHistory()
+	if err != nil {
+		return
+	}
+	entry := historyEntry{ID: ID, Time: time.Now().UTC(), AzureDir: c.azureDir}
+	if !strings.EqualFold(previous, ID) {
+		entry.Previous = previous
+	}
+	entries = append([]historyEntry{entry}, entries...)
+	if len(entries) > maxHistory {
+		entries = entries[:maxHistory]
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return
+	}
+	writeFileAtomic(c.historyFile(), append(data, '\n'), 0644)
+}
+
+// defaultSubscriptionID returns the default subscription in azureProfile.json,
+// or "" when it cannot be read.
+func (c *config) defaultSubscriptionID() string {
+	subs, err := c.getSubscriptionsFromFile()
+	if err != nil {
+		return ""
+	}
+	for _, s := range subs {
+		if s.Selected {
+			return s.ID
+		}
+	}
+	return ""
+}
+
+// previousSubscription returns the most recent subscription in the history
+// other than current.
+func previousSubscription(entries []historyEntry, current string) (string, bool) {
+	for _, e := range entries {
+		for _, id := range []string{e.ID, e.Previous} {
+			if id != "" && !strings.EqualFold(id, current) {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// runPreviousCommand switches back to the previously used subscription, like
+// 'cd -'.
+func runPreviousCommand(ctx context.Context, cfg *config, opts options) error {
+	entries, err := cfg.loadHistory()
+	if err != nil {
+		return err
+	}
+	aliases, err := selectableSubscriptions(cfg, opts)
+	if err != nil {
+		return err
+	}
+	current := ""
+	for _, s := range aliases {
+		if s.Selected {
+			current = s.ID
+		}
+	}
+
+	id, ok := previousSubscription(entries, current)
+	if !ok {
+		return fmt.Errorf("no previous subscription in the history")
+	}
+	for _, s := range aliases {
+		if strings.EqualFold(s.ID, id) {
+			if err := cfg.setSubscription(ctx, s.ID, s.Cloud); err != nil {
+				return &azureError{err}
+			}
+			fmt.Printf("Selected %s with ID %s\n", s.Name, s.ID)
+			return nil
+		}
+	}
+	return &notFoundError{Query: id}
+}
+
+// runHistoryCommand lists the recent switches.
+func runHistoryCommand(cfg *config) error {
+	entries, err := cfg.loadHistory()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No subscription switches recorded yet")
+		return nil
+	}
+
+	// Names and aliases are looked up now, so renamed subscriptions show
+	// their current name.
+	byID := map[string]subscriptionAlias{}
+	if aliases, err := cfg.subscriptionAliases(); err == nil {
+		for _, s := range aliases {
+			byID[strings.ToLower(s.ID)] = s
+		}
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("Time", "Alias", "Name", "ID")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, e := range entries {
+		s, ok := byID[strings.ToLower(e.ID)]
+		if !ok {
+			s = subscriptionAlias{Name: "(unknown)"}
+		}
+		tbl.AddRow(e.Time.Local().Format("2006-01-02 15:04:05"), s.Alias, s.Name, e.ID)
+	}
+	tbl.Print()
+	return nil
+}
+
+// sortByRecent orders the most recently used subscriptions first. Unused
+// subscriptions follow in their original order, and indexes are kept.
+func sortByRecent(aliases []subscriptionAlias, entries []historyEntry) {
+	used := map[string]time.Time{}
+	for _, e := range entries {
+		id := strings.ToLower(e.ID)
+		if e.Time.After(used[id]) {
+			used[id] = e.Time
+		}
+	}
+	sort.SliceStable(aliases, func(i, j int) bool {
+		return used[strings.ToLower(aliases[i].ID)].After(used[strings.ToLower(aliases[j].ID)])
+	})
+}
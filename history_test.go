@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSwitchBack(t *testing.T) {
+	c := testConfig(t, `{"subscriptions": [
+		{"name": "prod", "id": "`+testSubA+`", "isDefault": true},
+		{"name": "dev", "id": "`+testSubB+`", "isDefault": false},
+		{"name": "test", "id": "`+testSubC+`", "isDefault": false}
+	]}`)
+	ctx := context.Background()
+
+	if err := runPreviousCommand(ctx, c, options{}); err == nil {
+		t.Fatalf("Expected error without history, got none")
+	}
+
+	// The first switch already knows where it came from.
+	if err := runUseCommand(ctx, c, options{}, []string{"dev"}); err != nil {
+		t.Fatalf("Failed to use dev: %v", err)
+	}
+	if err := runPreviousCommand(ctx, c, options{}); err != nil {
+		t.Fatalf("Failed to switch back: %v", err)
+	}
+	if id := c.defaultSubscriptionID(); id != testSubA {
+		t.Fatalf("Expected to be back on prod, got %s", id)
+	}
+	if err := runPreviousCommand(ctx, c, options{}); err != nil {
+		t.Fatalf("Failed to switch back again: %v", err)
+	}
+	if id := c.defaultSubscriptionID(); id != testSubB {
+		t.Fatalf("Expected to toggle to dev, got %s", id)
+	}
+
+	entries, err := c.loadHistory()
+	if err != nil || len(entries) != 3 || entries[0].ID != testSubB || entries[0].Previous != testSubA {
+		t.Fatalf("Unexpected history: %+v, %v", entries, err)
+	}
+
+	// Another Azure config directory has its own history.
+	c.setAzureDir(t.TempDir())
+	if entries, err := c.loadHistory(); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected no history for another config dir, got: %+v, %v", entries, err)
+	}
+}
+
+func TestSortByRecent(t *testing.T) {
+	now := time.Now()
+	aliases := []subscriptionAlias{{Index: 1, ID: testSubA}, {Index: 2, ID: testSubB}, {Index: 3, ID: testSubC}}
+	entries := []historyEntry{
+		{ID: testSubB, Time: now},
+		{ID: testSubC, Time: now.Add(-time.Hour)},
+		{ID: testSubB, Time: now.Add(-2 * time.Hour)},
+	}
+	sortByRecent(aliases, entries)
+	if aliases[0].Index != 2 || aliases[1].Index != 3 || aliases[2].Index != 1 {
+		t.Fatalf("Unexpected order: %+v", aliases)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const hookUsage = `Usage: az-wrap hook <bash|zsh|fish|pwsh> [-switch]
+
+Prints a shell hook that checks the .az-wrap binding whenever the directory
+changes. By default it warns when the active subscription differs, with
+-switch it switches. Add it to your shell profile:
+
+  bash  eval "$(az-wrap hook bash)"         in ~/.bashrc
+  zsh   eval "$(az-wrap hook zsh)"          in ~/.zshrc
+  fish  az-wrap hook fish | source          in ~/.config/fish/config.fish
+  pwsh  az-wrap hook pwsh | Out-String | Invoke-Expression   in $PROFILE`
+
+// hookScripts run the binding check on directory changes. %[1]s is the
+// quoted command to run.
+var hookScripts = map[string]string{
+	"bash": `_az_wrap_hook() {
+  if [ "$PWD" != "${_AZ_WRAP_LAST_DIR:-}" ]; then
+    _AZ_WRAP_LAST_DIR="$PWD"
+    %[1]s
+  fi
+}
+case ";${PROMPT_COMMAND:-};" in
+  *";_az_wrap_hook;"*) ;;
+  *) PROMPT_COMMAND="_az_wrap_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}" ;;
+esac
+`,
+	"zsh": `_az_wrap_hook() {
+  %[1]s
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook chpwd _az_wrap_hook
+_az_wrap_hook
+`,
+	"fish": `function __az_wrap_hook --on-variable PWD
+    %[1]s
+end
+__az_wrap_hook
+`,
+	"pwsh": `$global:__AzWrapLastDir = $null
+$global:__AzWrapPrompt = $function:prompt
+function global:prompt {
+    if ($PWD.Path -ne $global:__AzWrapLastDir) {
+        $global:__AzWrapLastDir = $PWD.Path
+        %[1]s
+    }
+    & $global:__AzWrapPrompt
+}
+`,
+}
+
+// runHookCommand prints the binding hook for a shell.
+func runHookCommand(args []string) error {
+	fs := flag.NewFlagSet("hook", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), hookUsage) }
+	switchTo := fs.Bool("switch", false, "Switch to the bound subscription instead of warning")
+	rest := parseArgs(fs, args)
+	if len(rest) != 1 {
+		return fmt.Errorf(hookUsage)
+	}
+	shell := strings.ToLower(rest[0])
+	script, ok := hookScripts[shell]
+	if !ok {
+		return fmt.Errorf("unknown shell '%s'\n\n%s", rest[0], hookUsage)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "az-wrap"
+	}
+	command := []string{quoteArg(shell, exe), "__check-binding"}
+	if *switchTo {
+		command = append(command, "-switch")
+	}
+	if shell == "pwsh" {
+		command[0] = "& " + command[0]
+	}
+	fmt.Printf(script, strings.Join(command, " "))
+	return nil
+}
+
+// quoteArg quotes s as a literal argument for a shell.
+func quoteArg(shell, s string) string {
+	switch shell {
+	case "fish":
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+	case "pwsh":
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	default:
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+}
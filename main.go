@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 	"github.com/rodaine/table"
 )
 
@@ -20,37 +26,260 @@ func main() {
 		log.Fatalf("Error initializing config: %v", err)
 	}
 
-	alias := parseFlags()
-	if err := handleAliasFlag(cfg, alias); err != nil {
+	opts := parseFlags()
+	if opts.profile != "" {
+		if err := cfg.useProfile(opts.profile); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if len(opts.sources) > 0 {
+		cfg.sources = opts.sources
+	}
+	cfg.refresh = opts.refresh
+	if err := handleAliasFlag(cfg, opts.alias, opts.force); err != nil {
 		log.Fatalln(err)
 	}
+	if err := checkColumns(opts.columns); err != nil {
+		log.Fatalln(err)
+	}
+	if opts.sort != "index" && opts.sort != "recent" {
+		log.Fatalf("unknown sort order '%s', use index or recent", opts.sort)
+	}
 
-	aliases, err := cfg.subscriptionAliases()
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "alias":
+			if err := runAliasCommand(cfg, args[1:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "profile":
+			if err := runProfileCommand(cfg, args[1:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "pin", "unpin":
+			if err := runPinCommand(cfg, args[1:], args[0] == "pin"); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "bind":
+			if err := runBindCommand(cfg, args[1:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "hook":
+			if err := runHookCommand(args[1:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "__check-binding":
+			if err := runCheckBindingCommand(ctx, cfg, args[1:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "shell":
+			if err := runShellCommand(ctx, cfg, opts, args[1:]); err != nil {
+				exitUse(err)
+			}
+			return
+		case "completion":
+			if err := runCompletionCommand(args[1:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "prompt":
+			if err := runPromptCommand(cfg, args[1:]); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "__refresh-cache":
+			if err := runRefreshCacheCommand(ctx, cfg); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "__complete":
+			runCompleteCommand(cfg, args[1:])
+			return
+		case "exec":
+			code, err := runExecCommand(ctx, cfg, opts, args[1:])
+			if err != nil {
+				exitUse(err)
+			}
+			os.Exit(code)
+		case "foreach":
+			code, err := runForeachCommand(ctx, cfg, opts, args[1:])
+			if err != nil {
+				exitUse(err)
+			}
+			os.Exit(code)
+		case "az":
+			code, err := runAzCommand(ctx, cfg, args[1:])
+			if err != nil {
+				log.Fatalln(err)
+			}
+			os.Exit(code)
+		case "history":
+			if err := runHistoryCommand(cfg); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		case "-":
+			if err := runPreviousCommand(ctx, cfg, opts); err != nil {
+				exitUse(err)
+			}
+			return
+		case "use":
+			if err := runUseCommand(ctx, cfg, opts, args[1:]); err != nil {
+				exitUse(err)
+			}
+			return
+		default:
+			// A bare query is short for 'use', but only matches exactly or
+			// by prefix.
+			if len(args) != 1 {
+				log.Fatalf("unknown command '%s'", args[0])
+			}
+			if err := runBareQuery(ctx, cfg, opts, args[0]); err != nil {
+				exitUse(err)
+			}
+			return
+		}
+	}
+
+	aliases, err := selectableSubscriptions(cfg, opts)
 	if err != nil {
+		exitIfNotLoggedIn(err)
 		log.Fatalln(err)
 	}
+	if opts.sort == "recent" {
+		entries, err := cfg.loadHistory()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		sortByRecent(aliases, entries)
+	}
+	pinnedFirst(aliases)
+	// Always show the cloud once it makes a difference which one is meant.
+	columns := opts.columns
+	if multipleClouds(aliases) && !slices.Contains(columns, "cloud") {
+		columns = append(columns, "cloud")
+	}
+
+	if !opts.plain && isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd()) {
+		s, ok, err := runPicker(cfg, aliases, columns, opts.group)
+		switch {
+		case errors.Is(err, errNoTerminal):
+			// Fall back to the table.
+		case err != nil:
+			log.Fatalln(err)
+		case !ok:
+			return
+		default:
+			fmt.Printf("Selected %s with ID %s\n", s.Name, s.ID)
+			if err := cfg.setSubscription(ctx, s.ID, s.Cloud); err != nil {
+				log.Fatalln(err)
+			}
+			return
+		}
+	}
 
-	displayAliases(aliases)
+	color.New(color.Faint).Printf("Azure config: %s\n", cfg.describeConfigDir())
+	if !cfg.cachedAt.IsZero() {
+		cacheFmt := color.New(color.Faint)
+		if cfg.cacheStale {
+			cacheFmt = color.New(color.FgYellow)
+		}
+		cacheFmt.Printf("%s\n", cacheMarker(cfg.cachedAt, cfg.cacheStale))
+	}
+	if opts.group {
+		displayAliasesGrouped(aliases, columns)
+	} else {
+		displayAliases(aliases, columns)
+	}
 
 	selection := promptUserForSelection()
 	if err := selectSubscription(ctx, cfg, aliases, selection); err != nil {
-		fmt.Println("No subscriptions found")
+		log.Fatalln(err)
 	}
 }
 
-func parseFlags() string {
-	alias := flag.String("alias", "", "Set a subscription alias by <subscriptionId>:<alias>")
+// options are the global command line flags.
+type options struct {
+	alias   string
+	force   bool
+	columns []string
+	group   bool
+	tenant  string
+	cloud   string
+	profile string
+	sources []string
+	refresh bool
+	plain   bool
+	sort    string
+	pinned  bool
+}
+
+func parseFlags() options {
+	alias := flag.String("alias", "", "Set a subscription alias by <subscription>:<alias>, where subscription is an ID, name or index")
+	force := flag.Bool("force", false, "Skip validation when setting an alias")
+	columns := flag.String("columns", "", "Comma separated extra columns to show: "+strings.Join(optionalColumnNames(), ", "))
+	group := flag.Bool("group", false, "Group subscriptions by tenant")
+	tenant := flag.String("tenant", "", "Only show and select subscriptions of this tenant alias or ID")
+	cloud := flag.String("cloud", "", "Only show and select subscriptions of this cloud, such as AzureUSGovernment")
+	profile := flag.String("profile", "", "Use the Azure config directory of this az profile, see 'az-wrap profile'")
+	sources := flag.String("sources", "", "Comma separated subscription sources to try in order: file, cli, arm (default from AZ_WRAP_SOURCES or file,cli)")
+	refresh := flag.Bool("refresh", false, "Reload subscriptions from the Azure CLI instead of using the cache")
+	plain := flag.Bool("plain", false, "Print the table and prompt instead of the full-screen picker")
+	sortOrder := flag.String("sort", "index", "Order subscriptions by index or by most recently used (recent)")
+	pinned := flag.Bool("pinned", false, "Only show and select pinned subscriptions")
 	flag.Parse()
-	return *alias
+	return options{
+		alias:   *alias,
+		force:   *force,
+		columns: splitList(strings.ToLower(*columns)),
+		group:   *group,
+		tenant:  *tenant,
+		cloud:   *cloud,
+		profile: *profile,
+		sources: splitList(strings.ToLower(*sources)),
+		refresh: *refresh,
+		plain:   *plain,
+		sort:    strings.ToLower(*sortOrder),
+		pinned:  *pinned,
+	}
+}
+
+// parseArgs parses flags anywhere in args, not only before the first
+// positional argument, and returns the positional arguments. Everything after
+// "--" is returned as is.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if consumed := args[:len(args)-len(rest)]; len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
 }
 
-func handleAliasFlag(cfg *config, alias string) error {
+func handleAliasFlag(cfg *config, alias string, force bool) error {
 	if alias != "" {
 		parts := strings.SplitN(alias, ":", 2)
 		if len(parts) != 2 {
-			return fmt.Errorf("invalid alias format. Use <subscriptionId>:<alias>")
+			return fmt.Errorf("invalid alias format. Use <subscription>:<alias>")
+		}
+		id, err := prepareAlias(cfg, parts[0], parts[1], force)
+		if err != nil {
+			return err
 		}
-		if err := cfg.saveAliasFile(parts[0], parts[1]); err != nil {
+		if err := cfg.saveAliasFile(id, parts[1]); err != nil {
 			return fmt.Errorf("error saving alias: %w", err)
 		}
 		os.Exit(0)
@@ -58,22 +287,121 @@ func handleAliasFlag(cfg *config, alias string) error {
 	return nil
 }
 
-func displayAliases(aliases []subscriptionAlias) {
+// optionalColumns are the extra columns displayAliases can show on request.
+var optionalColumns = map[string]struct {
+	header string
+	value  func(s subscriptionAlias) string
+}{
+	"tenant":     {"Tenant", tenantLabel},
+	"hometenant": {"Home tenant", func(s subscriptionAlias) string { return s.HomeTenantID }},
+	"state":      {"State", func(s subscriptionAlias) string { return s.State }},
+	"user":       {"User", func(s subscriptionAlias) string { return s.User }},
+	"usertype":   {"User type", func(s subscriptionAlias) string { return s.UserType }},
+	"cloud":      {"Cloud", func(s subscriptionAlias) string { return s.Cloud }},
+	"managedby":  {"Managed by", func(s subscriptionAlias) string { return strings.Join(s.ManagedByTenants, ", ") }},
+}
+
+func optionalColumnNames() []string {
+	names := make([]string, 0, len(optionalColumns))
+	for name := range optionalColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkColumns(columns []string) error {
+	for _, c := range columns {
+		if _, ok := optionalColumns[c]; !ok {
+			return fmt.Errorf("unknown column '%s', use one of: %s", c, strings.Join(optionalColumnNames(), ", "))
+		}
+	}
+	return nil
+}
+
+func displayAliases(aliases []subscriptionAlias, columns []string) {
 	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
 	columnFmt := color.New(color.FgYellow).SprintfFunc()
 
-	tbl := table.New("Index", "Alias", "Name", "ID")
-	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	// Metadata columns are only shown when at least one subscription uses them.
+	var hasTags, hasOwner, hasNote bool
+	for _, s := range aliases {
+		hasTags = hasTags || len(s.Tags) > 0
+		hasOwner = hasOwner || s.Owner != ""
+		hasNote = hasNote || s.Note != ""
+	}
+
+	headers := []interface{}{"Index", "Alias", "Name", "ID"}
+	for _, c := range columns {
+		headers = append(headers, optionalColumns[c].header)
+	}
+	if hasTags {
+		headers = append(headers, "Tags")
+	}
+	if hasOwner {
+		headers = append(headers, "Owner")
+	}
+	if hasNote {
+		headers = append(headers, "Note")
+	}
+
+	tbl := table.New(headers...)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWidthFunc(visibleWidth)
 	for _, s := range aliases {
 		id := s.ID
 		if s.Selected {
 			id = color.New(color.BgBlue, color.FgWhite).Sprint(id)
 		}
-		tbl.AddRow(s.Index, s.Alias, s.Name, id)
+		alias := s.Alias
+		if len(s.Aliases) > 0 {
+			alias = strings.Join(s.Aliases, ", ")
+		}
+		if attr, ok := aliasColors[s.Color]; ok {
+			alias = color.New(attr).Sprint(alias)
+		}
+
+		row := []interface{}{indexLabel(s), alias, subscriptionName(s), id}
+		for _, c := range columns {
+			row = append(row, optionalColumns[c].value(s))
+		}
+		if hasTags {
+			row = append(row, strings.Join(s.Tags, ", "))
+		}
+		if hasOwner {
+			row = append(row, s.Owner)
+		}
+		if hasNote {
+			row = append(row, s.Note)
+		}
+		tbl.AddRow(row...)
 	}
 	tbl.Print()
 }
 
+// subscriptionName returns the name of a subscription marked up with its
+// state, so disabled, warned and delegated subscriptions stand out.
+func subscriptionName(s subscriptionAlias) string {
+	name := s.Name
+	switch {
+	case s.State == "" || strings.EqualFold(s.State, "Enabled"):
+	case strings.EqualFold(s.State, "Disabled"):
+		name = color.New(color.FgRed).Sprintf("%s [%s]", name, s.State)
+	default:
+		name = color.New(color.FgYellow).Sprintf("%s [%s]", name, s.State)
+	}
+	if s.delegated() {
+		name += color.New(color.FgCyan).Sprint(" [Lighthouse]")
+	}
+	return name
+}
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// visibleWidth is the width of s on screen, ignoring color escape codes.
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(ansiEscape.ReplaceAllString(s, ""))
+}
+
 func promptUserForSelection() string {
 	var selection string
 	color.New(color.FgGreen).Print("\nEnter Index, Alias, Name or ID to select: ")
@@ -81,18 +409,47 @@ func promptUserForSelection() string {
 	return strings.ToLower(selection)
 }
 
+// selectSubscription switches to the subscription the selection matches best.
+// When several match equally well, the user picks one of them.
 func selectSubscription(ctx context.Context, cfg *config, aliases []subscriptionAlias, selection string) error {
+	for {
+		s, err := resolveSubscription(aliases, selection)
+		var ambiguous *ambiguousError
+		if errors.As(err, &ambiguous) {
+			color.New(color.FgYellow).Printf("\n%s:\n", ambiguous)
+			displayAliases(ambiguous.Matches, nil)
+			aliases = ambiguous.Matches
+			selection = promptUserForSelection()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Selected %s with ID %s\n", s.Name, s.ID)
+		if err := cfg.setSubscription(ctx, s.ID, s.Cloud); err != nil {
+			return err
+		}
+		os.Exit(0)
+	}
+}
+
+// findSubscription returns the first subscription whose index, alias, name or
+// ID equals the selection, ignoring case.
+func findSubscription(aliases []subscriptionAlias, selection string) (subscriptionAlias, bool) {
+	selection = strings.ToLower(selection)
 	for _, s := range aliases {
 		if selection == strconv.Itoa(s.Index) ||
 			selection == strings.ToLower(s.Alias) ||
 			selection == strings.ToLower(s.Name) ||
 			selection == strings.ToLower(s.ID) {
-			fmt.Printf("Selected %s with ID %s\n", s.Name, s.ID)
-			if err := cfg.setSubscription(ctx, s.ID); err != nil {
-				return err
+			return s, true
+		}
+		for _, a := range s.Aliases {
+			if selection == strings.ToLower(a) {
+				return s, true
 			}
-			os.Exit(0)
 		}
 	}
-	return fmt.Errorf("subscription not found")
+	return subscriptionAlias{}, false
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// matchRank orders how well a query matches a subscription, best first.
+type matchRank int
+
+const (
+	matchExact matchRank = iota
+	matchPrefix
+	matchTokenPrefix
+	matchSubstring
+	matchFuzzy
+	noMatch
+)
+
+// subscriptionMatch is a subscription matched by a query.
+type subscriptionMatch struct {
+	Subscription subscriptionAlias
+	Rank         matchRank
+}
+
+// notFoundError is returned when no subscription matches a query.
+type notFoundError struct {
+	Query string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("no subscription matches '%s'", e.Query)
+}
+
+// ambiguousError is returned when a query matches several subscriptions
+// equally well.
+type ambiguousError struct {
+	Query   string
+	Matches []subscriptionAlias
+}
+
+func (e *ambiguousError) Error() string {
+	return fmt.Sprintf("'%s' matches %d subscriptions", e.Query, len(e.Matches))
+}
+
+// matchSubscriptions ranks the subscriptions matching query by their index,
+// aliases, name and ID, best match first and then by index.
+func matchSubscriptions(aliases []subscriptionAlias, query string) []subscriptionMatch {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	var matches []subscriptionMatch
+	for _, s := range aliases {
+		rank := noMatch
+		if query == strconv.Itoa(s.Index) {
+			rank = matchExact
+		}
+		names := append([]string{s.Name}, s.Aliases...)
+		if s.Alias != "(no alias)" {
+			names = append(names, s.Alias)
+		}
+		for _, name := range names {
+			rank = min(rank, rankText(query, strings.ToLower(name), true))
+		}
+		// IDs are hex, so only match them from the start.
+		rank = min(rank, rankText(query, strings.ToLower(s.ID), false))
+		if rank != noMatch {
+			matches = append(matches, subscriptionMatch{Subscription: s, Rank: rank})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank < matches[j].Rank
+		}
+		return matches[i].Subscription.Index < matches[j].Subscription.Index
+	})
+	return matches
+}
+
+// rankText ranks how well query matches text. Loose matching allows token
+// prefixes, substrings and fuzzy matches on top of exact and prefix matches.
+func rankText(query, text string, loose bool) matchRank {
+	switch {
+	case text == "":
+		return noMatch
+	case query == text:
+		return matchExact
+	case strings.HasPrefix(text, query):
+		return matchPrefix
+	case !loose:
+		return noMatch
+	case tokenPrefixMatch(tokens(query), tokens(text)):
+		return matchTokenPrefix
+	case strings.Contains(text, query):
+		return matchSubstring
+	case fuzzyMatch(query, text):
+		return matchFuzzy
+	}
+	return noMatch
+}
+
+// tokens splits s into words at anything that is not a letter or digit.
+func tokens(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tokenPrefixMatch reports whether every query token is the prefix of a text
+// token, in order. "pay-pr" matches "payments-prod".
+func tokenPrefixMatch(query, text []string) bool {
+	if len(query) == 0 {
+		return false
+	}
+	i := 0
+	for _, t := range text {
+		if i < len(query) && strings.HasPrefix(t, query[i]) {
+			i++
+		}
+	}
+	return i == len(query)
+}
+
+// fuzzyMatch reports whether the characters of query appear in text in order.
+func fuzzyMatch(query, text string) bool {
+	for _, r := range query {
+		i := strings.IndexRune(text, r)
+		if i < 0 {
+			return false
+		}
+		text = text[i+len(string(r)):]
+	}
+	return true
+}
+
+// resolveSubscription returns the subscription query selects. Only the best
+// ranked matches count, so an exact match wins over any number of fuzzy
+// ones. Several matches of the same rank return an *ambiguousError.
+func resolveSubscription(aliases []subscriptionAlias, query string) (subscriptionAlias, error) {
+	matches := matchSubscriptions(aliases, query)
+	if len(matches) == 0 {
+		return subscriptionAlias{}, &notFoundError{Query: query}
+	}
+
+	var best []subscriptionAlias
+	for _, m := range matches {
+		if m.Rank == matches[0].Rank {
+			best = append(best, m.Subscription)
+		}
+	}
+	if len(best) > 1 {
+		return subscriptionAlias{}, &ambiguousError{Query: query, Matches: best}
+	}
+	return best[0], nil
+}
+
+// resolvePrefix returns the subscription query selects by its index, or by
+// an exact or prefix match of an alias, name or ID. A bare 'az-wrap <query>'
+// uses it, so a mistyped command never switches subscriptions on a loose
+// match.
+func resolvePrefix(aliases []subscriptionAlias, query string) (subscriptionAlias, error) {
+	return resolveRanked(aliases, query, matchPrefix)
+}
+
+// resolveExact returns the subscription with query as its index, alias, name
+// or ID.
+func resolveExact(aliases []subscriptionAlias, query string) (subscriptionAlias, error) {
+	return resolveRanked(aliases, query, matchExact)
+}
+
+// resolveRanked is resolveSubscription without matches looser than loosest.
+func resolveRanked(aliases []subscriptionAlias, query string, loosest matchRank) (subscriptionAlias, error) {
+	matches := matchSubscriptions(aliases, query)
+	var best []subscriptionAlias
+	for _, m := range matches {
+		if m.Rank > loosest || m.Rank != matches[0].Rank {
+			break
+		}
+		best = append(best, m.Subscription)
+	}
+	switch len(best) {
+	case 0:
+		return subscriptionAlias{}, &notFoundError{Query: query}
+	case 1:
+		return best[0], nil
+	}
+	return subscriptionAlias{}, &ambiguousError{Query: query, Matches: best}
+}
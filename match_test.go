@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveSubscription(t *testing.T) {
+	aliases := []subscriptionAlias{
+		{Index: 1, Name: "payments-prod", ID: testSubA, Alias: "(no alias)"},
+		{Index: 2, Name: "payments-dev", ID: testSubB, Alias: "pdev", Aliases: []string{"pdev"}},
+		{Index: 3, Name: "corp-0042-weu-prod-platform", ID: testSubC, Alias: "(no alias)"},
+	}
+
+	tests := map[string]string{
+		"1":             testSubA,
+		"PDEV":          testSubB,
+		"pay-pr":        testSubA,
+		"payments-d":    testSubB,
+		"platform":      testSubC,
+		"cwpp":          testSubC,
+		"3333":          testSubC,
+		"payments-prod": testSubA,
+	}
+	for query, want := range tests {
+		s, err := resolveSubscription(aliases, query)
+		if err != nil || s.ID != want {
+			t.Errorf("Expected '%s' to select %s, got: %s, %v", query, want, s.ID, err)
+		}
+	}
+
+	_, err := resolveSubscription(aliases, "payments")
+	var ambiguous *ambiguousError
+	if !errors.As(err, &ambiguous) || len(ambiguous.Matches) != 2 || ambiguous.Matches[0].Index != 1 {
+		t.Errorf("Expected 'payments' to be ambiguous between 1 and 2, got: %v", err)
+	}
+
+	_, err = resolveSubscription(aliases, "nothing")
+	var notFound *notFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("Expected 'nothing' not to be found, got: %v", err)
+	}
+
+	// The placeholder of subscriptions without alias is not an alias.
+	if matches := matchSubscriptions(aliases, "(no alias)"); len(matches) != 0 {
+		t.Errorf("Expected the no alias placeholder not to match, got: %v", matches)
+	}
+}
+
+func TestRankText(t *testing.T) {
+	tests := []struct {
+		query, text string
+		want        matchRank
+	}{
+		{"prod", "prod", matchExact},
+		{"pay", "payments-prod", matchPrefix},
+		{"pay-pr", "payments-prod", matchTokenPrefix},
+		{"pr-pay", "payments-prod", noMatch},
+		{"ments", "payments-prod", matchSubstring},
+		{"pmp", "payments-prod", matchFuzzy},
+		{"xyz", "payments-prod", noMatch},
+	}
+	for _, tt := range tests {
+		if got := rankText(tt.query, tt.text, true); got != tt.want {
+			t.Errorf("Expected rank %d for '%s' in '%s', got %d", tt.want, tt.query, tt.text, got)
+		}
+	}
+	if got := rankText("ments", "payments-prod", false); got != noMatch {
+		t.Errorf("Expected no substring match without loose matching, got %d", got)
+	}
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+)
+
+// errNoTerminal is returned when the picker cannot take over the terminal, in
+// which case the table is shown instead.
+var errNoTerminal = errors.New("not an interactive terminal")
+
+// keyCode is a key the picker reacts to.
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyClear
+	keyAlias
+	keyGroup
+	keyQuit
+)
+
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// decodeKeys turns the bytes of one terminal read into keys. A lone escape
+// byte is the Esc key, otherwise it starts an escape sequence.
+func decodeKeys(b []byte) []key {
+	var keys []key
+	for len(b) > 0 {
+		switch {
+		case b[0] == 0x1b && len(b) == 1:
+			keys = append(keys, key{code: keyEscape})
+			b = b[1:]
+		case b[0] == 0x1b && len(b) > 2 && (b[1] == '[' || b[1] == 'O'):
+			seq := b[2:]
+			end := 0
+			for end < len(seq) && (seq[end] < 0x40 || seq[end] > 0x7e) {
+				end++
+			}
+			if end == len(seq) {
+				return keys
+			}
+			switch string(seq[:end+1]) {
+			case "A":
+				keys = append(keys, key{code: keyUp})
+			case "B":
+				keys = append(keys, key{code: keyDown})
+			case "5~":
+				keys = append(keys, key{code: keyPageUp})
+			case "6~":
+				keys = append(keys, key{code: keyPageDown})
+			case "H", "1~":
+				keys = append(keys, key{code: keyHome})
+			case "F", "4~":
+				keys = append(keys, key{code: keyEnd})
+			}
+			b = seq[end+1:]
+		case b[0] == 0x1b:
+			// Alt combinations and unknown sequences are ignored.
+			b = b[min(2, len(b)):]
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, key{code: keyEnter})
+			b = b[1:]
+		case b[0] == 0x7f || b[0] == 0x08:
+			keys = append(keys, key{code: keyBackspace})
+			b = b[1:]
+		case b[0] == 0x01:
+			keys = append(keys, key{code: keyAlias})
+			b = b[1:]
+		case b[0] == 0x07:
+			keys = append(keys, key{code: keyGroup})
+			b = b[1:]
+		case b[0] == 0x0e:
+			keys = append(keys, key{code: keyDown})
+			b = b[1:]
+		case b[0] == 0x10:
+			keys = append(keys, key{code: keyUp})
+			b = b[1:]
+		case b[0] == 0x15:
+			keys = append(keys, key{code: keyClear})
+			b = b[1:]
+		case b[0] == 0x03 || b[0] == 0x04:
+			keys = append(keys, key{code: keyQuit})
+			b = b[1:]
+		default:
+			r, size := utf8.DecodeRune(b)
+			if unicode.IsPrint(r) {
+				keys = append(keys, key{code: keyRune, r: r})
+			}
+			b = b[size:]
+		}
+	}
+	return keys
+}
+
+// picker is the state of the full-screen subscription picker.
+type picker struct {
+	all     []subscriptionAlias
+	columns []string
+	grouped bool
+	header  string
+
+	query   []rune
+	matches []subscriptionAlias
+	cursor  int
+	offset  int
+
+	// editing is set while an alias for the subscription under the cursor
+	// is typed into input.
+	editing bool
+	input   []rune
+	message string
+
+	// setAlias saves an alias and returns the subscription's aliases.
+	setAlias func(id, alias string) ([]string, error)
+
+	done   bool
+	chosen *subscriptionAlias
+}
+
+func newPicker(aliases []subscriptionAlias, columns []string, grouped bool) *picker {
+	p := &picker{all: aliases, columns: columns, grouped: grouped}
+	p.filter()
+	// Start on the subscription that is currently selected.
+	for i, s := range p.matches {
+		if s.Selected {
+			p.cursor = i
+		}
+	}
+	return p
+}
+
+// filter updates the matches for the query, ordered by tenant when grouped.
+func (p *picker) filter() {
+	p.matches = p.all
+	if len(p.query) > 0 {
+		p.matches = nil
+		for _, m := range matchSubscriptions(p.all, string(p.query)) {
+			p.matches = append(p.matches, m.Subscription)
+		}
+	}
+	if p.grouped {
+		var grouped []subscriptionAlias
+		for _, group := range groupByTenant(p.matches) {
+			grouped = append(grouped, group...)
+		}
+		p.matches = grouped
+	}
+	p.cursor, p.offset = 0, 0
+}
+
+// handle applies a key to the picker.
+func (p *picker) handle(k key) {
+	p.message = ""
+	if p.editing {
+		p.handleAliasInput(k)
+		return
+	}
+
+	switch k.code {
+	case keyRune:
+		p.query = append(p.query, k.r)
+		p.filter()
+	case keyBackspace:
+		if len(p.query) > 0 {
+			p.query = p.query[:len(p.query)-1]
+			p.filter()
+		}
+	case keyClear:
+		p.query = nil
+		p.filter()
+	case keyUp:
+		p.move(-1)
+	case keyDown:
+		p.move(1)
+	case keyPageUp:
+		p.move(-10)
+	case keyPageDown:
+		p.move(10)
+	case keyHome:
+		p.move(-len(p.matches))
+	case keyEnd:
+		p.move(len(p.matches))
+	case keyGroup:
+		id := p.current()
+		p.grouped = !p.grouped
+		p.filter()
+		p.moveTo(id)
+	case keyAlias:
+		if len(p.matches) > 0 {
+			p.editing, p.input = true, nil
+		}
+	case keyEnter:
+		if len(p.matches) > 0 {
+			s := p.matches[p.cursor]
+			p.chosen, p.done = &s, true
+		}
+	case keyEscape, keyQuit:
+		p.done = true
+	}
+}
+
+func (p *picker) handleAliasInput(k key) {
+	switch k.code {
+	case keyRune:
+		p.input = append(p.input, k.r)
+	case keyBackspace:
+		if len(p.input) > 0 {
+			p.input = p.input[:len(p.input)-1]
+		}
+	case keyEscape, keyQuit:
+		p.editing = false
+	case keyEnter:
+		p.editing = false
+		s := &p.matches[p.cursor]
+		alias := strings.TrimSpace(string(p.input))
+		aliases, err := p.setAlias(s.ID, alias)
+		var invalid *aliasValidationError
+		switch {
+		case errors.As(err, &invalid):
+			p.message = fmt.Sprintf("invalid alias '%s': %s", alias, strings.Join(invalid.Problems, "; "))
+			return
+		case err != nil:
+			p.message = err.Error()
+			return
+		}
+		for i := range p.all {
+			if p.all[i].ID == s.ID {
+				p.all[i].Alias, p.all[i].Aliases = alias, aliases
+			}
+		}
+		s.Alias, s.Aliases = alias, aliases
+		p.message = fmt.Sprintf("Alias '%s' set for %s", alias, s.Name)
+	}
+}
+
+// current returns the ID under the cursor.
+func (p *picker) current() string {
+	if len(p.matches) == 0 {
+		return ""
+	}
+	return p.matches[p.cursor].ID
+}
+
+func (p *picker) moveTo(id string) {
+	for i, s := range p.matches {
+		if s.ID == id {
+			p.cursor = i
+		}
+	}
+}
+
+func (p *picker) move(delta int) {
+	p.cursor = max(0, min(len(p.matches)-1, p.cursor+delta))
+}
+
+// pickerLine is a line of the list, either a tenant header or a row.
+type pickerLine struct {
+	text string
+	row  int
+}
+
+// render draws the picker into a width by height screen.
+func (p *picker) render(w io.Writer, width, height int) {
+	headers := []string{"Index", "Alias", "Name", "ID"}
+	for _, c := range p.columns {
+		headers = append(headers, optionalColumns[c].header)
+	}
+	cells := make([][]string, len(p.matches))
+	widths := make([]int, len(headers))
+	for i, h := range headers {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for i, s := range p.matches {
+		alias := s.Alias
+		if len(s.Aliases) > 0 {
+			alias = strings.Join(s.Aliases, ", ")
+		}
+		row := []string{indexLabel(s), alias, ansiEscape.ReplaceAllString(subscriptionName(s), ""), s.ID}
+		for _, c := range p.columns {
+			row = append(row, optionalColumns[c].value(s))
+		}
+		for j, cell := range row {
+			widths[j] = max(widths[j], utf8.RuneCountInString(cell))
+		}
+		cells[i] = row
+	}
+	format := func(row []string) string {
+		var b strings.Builder
+		for j, cell := range row {
+			b.WriteString(cell)
+			if j < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell)+2))
+			}
+		}
+		return b.String()
+	}
+
+	var lines []pickerLine
+	cursorLine := 0
+	for i := range p.matches {
+		if p.grouped && (i == 0 || !strings.EqualFold(p.matches[i-1].TenantID, p.matches[i].TenantID)) {
+			count := 0
+			for _, s := range p.matches[i:] {
+				if strings.EqualFold(s.TenantID, p.matches[i].TenantID) {
+					count++
+				}
+			}
+			lines = append(lines, pickerLine{text: fmt.Sprintf("Tenant %s, subscriptions: %d", tenantLabel(p.matches[i]), count), row: -1})
+		}
+		if i == p.cursor {
+			cursorLine = len(lines)
+		}
+		lines = append(lines, pickerLine{text: format(cells[i]), row: i})
+	}
+
+	// Keep the cursor on screen below the prompt, status and header lines.
+	visible := max(1, height-4)
+	if cursorLine < p.offset {
+		p.offset = cursorLine
+	}
+	if cursorLine >= p.offset+visible {
+		p.offset = cursorLine - visible + 1
+	}
+	if p.offset > 0 && p.offset >= len(lines) {
+		p.offset = max(0, len(lines)-visible)
+	}
+
+	fit := func(s string) string {
+		if utf8.RuneCountInString(s) <= width {
+			return s
+		}
+		return string([]rune(s)[:max(0, width)])
+	}
+
+	promptFmt := color.New(color.FgGreen).SprintFunc()
+	faint := color.New(color.Faint).SprintFunc()
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintFunc()
+	tenantFmt := color.New(color.FgCyan, color.Bold).SprintFunc()
+	cursorFmt := color.New(color.ReverseVideo).SprintFunc()
+	selectedFmt := color.New(color.FgBlue, color.Bold).SprintFunc()
+
+	out := bufio.NewWriter(w)
+	out.WriteString("\x1b[H")
+	writeLine := func(s string) { out.WriteString(s + "\x1b[K\r\n") }
+
+	prompt := "> "
+	input := string(p.query)
+	if p.editing {
+		prompt = fmt.Sprintf("Alias for %s: ", p.matches[p.cursor].Name)
+		input = string(p.input)
+	}
+	writeLine(promptFmt(prompt) + fit(input))
+
+	status := p.message
+	if status == "" {
+		status = fmt.Sprintf("%d/%d  %s  ↑↓ move  enter switch  esc quit  ctrl-a alias  ctrl-g group", len(p.matches), len(p.all), p.header)
+	}
+	writeLine(faint(fit(status)))
+	writeLine("  " + headerFmt(fit(format(headers))))
+
+	for _, l := range lines[p.offset:min(len(lines), p.offset+visible)] {
+		if l.row < 0 {
+			writeLine(tenantFmt(fit(l.text)))
+			continue
+		}
+		s := p.matches[l.row]
+		marker := "  "
+		if s.Selected {
+			marker = "* "
+		}
+		text := fit(marker + l.text)
+		switch {
+		case l.row == p.cursor:
+			text = cursorFmt(text)
+		case s.Selected:
+			text = selectedFmt(text)
+		}
+		writeLine(text)
+	}
+	if len(lines) == 0 {
+		writeLine(faint("  No subscriptions match"))
+	}
+	out.WriteString("\x1b[J")
+
+	// Put the cursor at the end of the input.
+	col := utf8.RuneCountInString(prompt) + len([]rune(input)) + 1
+	fmt.Fprintf(out, "\x1b[1;%dH", min(col, max(1, width)))
+	out.Flush()
+}
+
+// runPicker shows the full-screen picker and returns the chosen subscription,
+// or false when the user quit. errNoTerminal is returned when the terminal
+// cannot be used.
+func runPicker(cfg *config, aliases []subscriptionAlias, columns []string, grouped bool) (subscriptionAlias, bool, error) {
+	restore, err := makeRaw(os.Stdin, os.Stdout)
+	if err != nil {
+		return subscriptionAlias{}, false, err
+	}
+	defer restore()
+
+	// Use the alternate screen, so the shell is left as it was.
+	fmt.Print("\x1b[?1049h")
+	defer fmt.Print("\x1b[?1049l")
+
+	p := newPicker(aliases, columns, grouped)
+	p.header = cfg.describeConfigDir()
+	if cfg.cacheStale {
+		p.header += ", stale cache"
+	}
+	p.setAlias = func(id, alias string) ([]string, error) {
+		if _, err := prepareAlias(cfg, id, alias, false); err != nil {
+			return nil, err
+		}
+		if err := cfg.saveAliasFile(id, alias); err != nil {
+			return nil, err
+		}
+		store, err := cfg.loadMergedAliasStore()
+		if err != nil {
+			return nil, err
+		}
+		return store.meta(id).Aliases, nil
+	}
+
+	buf := make([]byte, 256)
+	for !p.done {
+		width, height, err := terminalSize(os.Stdout)
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24
+		}
+		p.render(os.Stdout, width, height)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return subscriptionAlias{}, false, fmt.Errorf("unable to read from the terminal: %w", err)
+		}
+		for _, k := range decodeKeys(buf[:n]) {
+			if !p.done {
+				p.handle(k)
+			}
+		}
+	}
+	if p.chosen == nil {
+		return subscriptionAlias{}, false, nil
+	}
+	return *p.chosen, true, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	keys := decodeKeys([]byte("a\x1b[A\x1b[B\x1b[6~é\r\x7f\x01\x07\x03"))
+	want := []keyCode{keyRune, keyUp, keyDown, keyPageDown, keyRune, keyEnter, keyBackspace, keyAlias, keyGroup, keyQuit}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %d keys, got %d: %v", len(want), len(keys), keys)
+	}
+	for i, k := range keys {
+		if k.code != want[i] {
+			t.Errorf("Expected key %d to be %d, got %d", i, want[i], k.code)
+		}
+	}
+	if keys[4].r != 'é' {
+		t.Errorf("Expected é, got %q", keys[4].r)
+	}
+	if keys := decodeKeys([]byte{0x1b}); len(keys) != 1 || keys[0].code != keyEscape {
+		t.Errorf("Expected a lone escape to be Esc, got %v", keys)
+	}
+}
+
+func typeKeys(p *picker, s string) {
+	for _, k := range decodeKeys([]byte(s)) {
+		p.handle(k)
+	}
+}
+
+func TestPicker(t *testing.T) {
+	aliases := []subscriptionAlias{
+		{Index: 1, Name: "payments-prod", ID: testSubA, Alias: "(no alias)", TenantID: "tenant-a"},
+		{Index: 2, Name: "shared", ID: testSubB, Alias: "(no alias)", TenantID: "tenant-b", Selected: true},
+		{Index: 3, Name: "payments-dev", ID: testSubC, Alias: "(no alias)", TenantID: "tenant-a"},
+	}
+	p := newPicker(aliases, nil, false)
+	if p.current() != testSubB {
+		t.Fatalf("Expected to start on the selected subscription, got %s", p.current())
+	}
+
+	typeKeys(p, "pay-d")
+	if len(p.matches) != 2 || p.current() != testSubC {
+		t.Fatalf("Expected payments-dev first when filtering, got %v", p.matches)
+	}
+	typeKeys(p, "\x7f\x7f")
+	if len(p.matches) != 2 || p.current() != testSubA {
+		t.Fatalf("Expected payments-prod first for 'pay', got %v", p.matches)
+	}
+	typeKeys(p, "\x15")
+	if len(p.matches) != 3 {
+		t.Fatalf("Expected every subscription after clearing, got %v", p.matches)
+	}
+
+	// Grouping keeps the cursor on the same subscription.
+	typeKeys(p, "\x1b[B\x1b[B\x07")
+	if !p.grouped || p.matches[1].ID != testSubC || p.current() != testSubC {
+		t.Fatalf("Expected grouping by tenant to keep payments-dev, got %v at %d", p.matches, p.cursor)
+	}
+
+	var saved string
+	p.setAlias = func(id, alias string) ([]string, error) {
+		if alias == "bad" {
+			return nil, &aliasValidationError{Alias: alias, Problems: []string{"clash"}}
+		}
+		saved = id + "=" + alias
+		return []string{alias}, nil
+	}
+	typeKeys(p, "\x01bad\r")
+	if p.message != "invalid alias 'bad': clash" || p.editing {
+		t.Errorf("Expected the validation problem as message, got %q", p.message)
+	}
+	typeKeys(p, "\x01pdev\r")
+	if saved != testSubC+"=pdev" || p.all[2].Alias != "pdev" {
+		t.Fatalf("Expected the alias to be saved and shown, got %q, %+v", saved, p.all[2])
+	}
+
+	var buf bytes.Buffer
+	p.render(&buf, 120, 10)
+	out := buf.String()
+	for _, want := range []string{"Tenant tenant-a, subscriptions: 2", "pdev", "* 2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q on screen, got:\n%s", want, out)
+		}
+	}
+
+	typeKeys(p, "\r")
+	if !p.done || p.chosen == nil || p.chosen.ID != testSubC {
+		t.Fatalf("Expected Enter to choose payments-dev, got %+v", p.chosen)
+	}
+
+	p = newPicker(aliases, nil, false)
+	typeKeys(p, "\x1b")
+	if !p.done || p.chosen != nil {
+		t.Fatalf("Expected Esc to quit without a choice")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// pinMarker is shown next to the index of pinned subscriptions.
+const pinMarker = "★"
+
+// setPinned pins or unpins a subscription in the user alias store.
+func (c *config) setPinned(subscriptionId string, pinned bool) error {
+	store, merged, err := c.loadAliasStores()
+	if err != nil {
+		return err
+	}
+
+	// The merged store only has a pin the user store lacks when it comes
+	// from a shared alias file.
+	if m, ok := merged.Subscriptions[subscriptionId]; ok && !pinned && m.Pinned && !store.meta(subscriptionId).Pinned {
+		return fmt.Errorf("subscription ID '%s' is pinned by a shared alias file and cannot be unpinned", subscriptionId)
+	}
+	store.meta(subscriptionId).Pinned = pinned
+
+	if err := c.saveAliasStore(store); err != nil {
+		return fmt.Errorf("error writing to alias file: %w", err)
+	}
+	return nil
+}
+
+// runPinCommand handles the "pin" and "unpin" subcommands.
+func runPinCommand(cfg *config, args []string, pinned bool) error {
+	command := "pin"
+	if !pinned {
+		command = "unpin"
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: az-wrap %s <subscription>...", command)
+	}
+
+	aliases, err := cfg.subscriptionAliases()
+	if err != nil {
+		return err
+	}
+	for _, query := range args {
+		s, err := resolveSubscription(aliases, query)
+		if err != nil {
+			return err
+		}
+		if err := cfg.setPinned(s.ID, pinned); err != nil {
+			return err
+		}
+		if pinned {
+			fmt.Printf("Pinned %s (%s).\n", s.Name, s.ID)
+		} else {
+			fmt.Printf("Unpinned %s (%s).\n", s.Name, s.ID)
+		}
+	}
+	return nil
+}
+
+// pinnedFirst moves pinned subscriptions to the top, keeping the order within
+// pinned and unpinned subscriptions. Indexes are kept.
+func pinnedFirst(aliases []subscriptionAlias) {
+	sort.SliceStable(aliases, func(i, j int) bool {
+		return aliases[i].Pinned && !aliases[j].Pinned
+	})
+}
+
+// filterPinned keeps the pinned subscriptions.
+func filterPinned(aliases []subscriptionAlias) []subscriptionAlias {
+	var pinned []subscriptionAlias
+	for _, s := range aliases {
+		if s.Pinned {
+			pinned = append(pinned, s)
+		}
+	}
+	return pinned
+}
+
+// indexLabel is the index shown for a subscription, marked when pinned.
+func indexLabel(s subscriptionAlias) string {
+	if s.Pinned {
+		return fmt.Sprintf("%d %s", s.Index, pinMarker)
+	}
+	return fmt.Sprint(s.Index)
+}
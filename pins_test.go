@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPins(t *testing.T) {
+	c := testConfig(t, "")
+	tempDir := c.stateDir
+	c.sharedStoreFiles = []aliasSource{{Name: teamAliasSource, Path: filepath.Join(tempDir, "team.json")}}
+
+	team := `{"version": 1, "subscriptions": {"sub-b": {"aliases": ["team-b"], "pinned": true}}}`
+	if err := os.WriteFile(filepath.Join(tempDir, "team.json"), []byte(team), 0644); err != nil {
+		t.Fatalf("Failed to write team.json: %v", err)
+	}
+
+	if err := c.setPinned("sub-a", true); err != nil {
+		t.Fatalf("Failed to pin: %v", err)
+	}
+	merged, err := c.loadMergedAliasStore()
+	if err != nil || !merged.Subscriptions["sub-a"].Pinned || !merged.Subscriptions["sub-b"].Pinned {
+		t.Fatalf("Expected sub-a and sub-b to be pinned, got: %v", err)
+	}
+
+	if err := c.setPinned("sub-b", false); err == nil {
+		t.Errorf("Expected error when unpinning a shared pin, got none")
+	}
+	if err := c.setPinned("sub-a", false); err != nil {
+		t.Fatalf("Failed to unpin: %v", err)
+	}
+	store, err := c.loadAliasStore()
+	if err != nil || len(store.Subscriptions) != 0 {
+		t.Fatalf("Expected the unpinned subscription to be pruned, got: %+v, %v", store.Subscriptions, err)
+	}
+}
+
+func TestPinnedFirst(t *testing.T) {
+	aliases := []subscriptionAlias{{Index: 1}, {Index: 2, Pinned: true}, {Index: 3}, {Index: 4, Pinned: true}}
+	pinnedFirst(aliases)
+	for i, want := range []int{2, 4, 1, 3} {
+		if aliases[i].Index != want {
+			t.Fatalf("Unexpected order: %+v", aliases)
+		}
+	}
+	if pinned := filterPinned(aliases); len(pinned) != 2 {
+		t.Errorf("Expected 2 pinned subscriptions, got %d", len(pinned))
+	}
+	if label := indexLabel(aliases[0]); label != "2 "+pinMarker {
+		t.Errorf("Expected the pin marker, got %s", label)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// utf8BOM is written by the Azure CLI at the start of azureProfile.json.
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// errUnfamiliarProfile is returned when azureProfile.json does not look like
+// the file the Azure CLI writes, in which case only the CLI should touch it.
+var errUnfamiliarProfile = errors.New("unfamiliar azureProfile.json layout")
+
+const (
+	profileLockTimeout = 5 * time.Second
+	// A lock older than this was left behind by a crashed process.
+	profileLockStale = 30 * time.Second
+)
+
+// setSubscriptionInProfile makes ID the default subscription by flipping
+// isDefault in azureProfile.json and setting the subscription of its cloud in
+// clouds.config, as 'az account set' does, without starting the Azure CLI. The
+// BOM and every field az-wrap does not know about are preserved.
+func (c *config) setSubscriptionInProfile(ID string) error {
+	unlock, err := lockFile(c.azureProfile+".lockfile", profileLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	info, err := os.Stat(c.azureProfile)
+	if err != nil {
+		return fmt.Errorf("unable to locate: %w", err)
+	}
+	data, err := os.ReadFile(c.azureProfile)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", c.azureProfile, err)
+	}
+
+	updated, selected, err := setDefaultSubscription(data, ID)
+	if err != nil {
+		return err
+	}
+
+	// The Azure CLI does not honor our lock, so make sure it did not write the
+	// file while we were working on it.
+	if now, err := os.Stat(c.azureProfile); err != nil || !now.ModTime().Equal(info.ModTime()) || now.Size() != info.Size() {
+		return fmt.Errorf("azureProfile.json changed while switching subscription")
+	}
+	if err := writeFileAtomic(c.azureProfile, updated, info.Mode().Perm()); err != nil {
+		return err
+	}
+	// Only once the profile is written, so a failed switch leaves both files
+	// as they were.
+	return c.setCloudSubscription(selected.Cloud, selected.ID)
+}
+
+// setCloudSubscription stores the default subscription of a cloud in
+// clouds.config, next to azureProfile.json.
+func (c *config) setCloudSubscription(cloud, ID string) error {
+	name := filepath.Join(filepath.Dir(c.azureProfile), "clouds.config")
+	perm := os.FileMode(0600)
+	data, err := os.ReadFile(name)
+	if err == nil {
+		if info, err := os.Stat(name); err == nil {
+			perm = info.Mode().Perm()
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("unable to read %s: %w", name, err)
+	}
+	return writeFileAtomic(name, setINIValue(data, cloud, "subscription", ID), perm)
+}
+
+// setDefaultSubscription returns the profile with ID as the only default
+// subscription, and the ID and cloud of that subscription as the profile
+// lists them. The ID must match exactly one subscription, anything else is
+// left to the Azure CLI.
+func setDefaultSubscription(data []byte, ID string) ([]byte, subscriptionAlias, error) {
+	bom := bytes.HasPrefix(data, utf8BOM)
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	var profile map[string]json.RawMessage
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, subscriptionAlias{}, fmt.Errorf("%w: %v", errUnfamiliarProfile, err)
+	}
+	var subs []map[string]json.RawMessage
+	if err := json.Unmarshal(profile["subscriptions"], &subs); err != nil || len(subs) == 0 {
+		return nil, subscriptionAlias{}, fmt.Errorf("%w: no subscriptions list", errUnfamiliarProfile)
+	}
+
+	found, selected := 0, subscriptionAlias{Cloud: defaultCloud}
+	for _, s := range subs {
+		var id string
+		var isDefault bool
+		if err := json.Unmarshal(s["id"], &id); err != nil || id == "" {
+			return nil, subscriptionAlias{}, fmt.Errorf("%w: subscription without id", errUnfamiliarProfile)
+		}
+		if err := json.Unmarshal(s["isDefault"], &isDefault); err != nil {
+			return nil, subscriptionAlias{}, fmt.Errorf("%w: subscription %s without isDefault", errUnfamiliarProfile, id)
+		}
+		isDefault = strings.EqualFold(id, ID)
+		s["isDefault"] = json.RawMessage(fmt.Sprint(isDefault))
+		if isDefault {
+			found++
+			selected.ID = id
+			var environment string
+			if err := json.Unmarshal(s["environmentName"], &environment); err == nil && environment != "" {
+				selected.Cloud = environment
+			}
+		}
+	}
+	switch {
+	case found == 0:
+		return nil, subscriptionAlias{}, fmt.Errorf("%w: subscription %s not found", errUnfamiliarProfile, ID)
+	case found > 1:
+		// The same subscription is listed for several users or tenants,
+		// and only the Azure CLI knows which one to pick.
+		return nil, subscriptionAlias{}, fmt.Errorf("%w: subscription %s is listed %d times", errUnfamiliarProfile, ID, found)
+	}
+
+	raw, err := marshalJSON(subs)
+	if err != nil {
+		return nil, subscriptionAlias{}, err
+	}
+	profile["subscriptions"] = raw
+	out, err := marshalJSON(profile)
+	if err != nil {
+		return nil, subscriptionAlias{}, err
+	}
+	if bom {
+		out = append(append([]byte(nil), utf8BOM...), out...)
+	}
+	return out, selected, nil
+}
+
+// marshalJSON encodes v compactly without escaping HTML characters, so
+// values copied from the original file are written back unchanged.
+func marshalJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// lockFile takes an exclusive lock by creating name, waiting up to timeout
+// for another process to release it. The returned function releases the lock.
+func lockFile(name string, timeout time.Duration) (func(), error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("unable to lock %s: %w", name, err)
+		}
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > profileLockStale {
+			os.Remove(name)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s", name)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
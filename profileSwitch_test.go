@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetSubscriptionInProfile(t *testing.T) {
+	c := testConfig(t, "")
+	tempDir := c.azureDir
+
+	profileContent := "\xef\xbb\xbf" + `{"installationId": "abc", "subscriptions": [
+		{"id": "sub-a", "name": "A <prod>", "isDefault": true, "user": {"name": "me", "type": "user"}, "future": [1, 2]},
+		{"id": "sub-b", "name": "B", "isDefault": false, "environmentName": "AzureCloud"}
+	]}`
+	if err := os.WriteFile(c.azureProfile, []byte(profileContent), 0600); err != nil {
+		t.Fatalf("Failed to write dummy azureProfile.json: %v", err)
+	}
+
+	if err := c.setSubscriptionInProfile("SUB-B"); err != nil {
+		t.Fatalf("Failed to switch subscription: %v", err)
+	}
+
+	content, err := os.ReadFile(c.azureProfile)
+	if err != nil {
+		t.Fatalf("Failed to read azureProfile.json: %v", err)
+	}
+	if !bytes.HasPrefix(content, utf8BOM) {
+		t.Fatalf("UTF-8 BOM was not preserved")
+	}
+	for _, want := range []string{`"installationId":"abc"`, `"future":[1,2]`, `"name":"A <prod>"`, `"user":{"name":"me","type":"user"}`} {
+		if !strings.Contains(string(content), want) {
+			t.Fatalf("Expected %s to be preserved, got: %s", want, content)
+		}
+	}
+
+	subs, err := c.getSubscriptionsFromFile()
+	if err != nil {
+		t.Fatalf("Failed to read switched profile: %v", err)
+	}
+	if subs[0].Selected || !subs[1].Selected {
+		t.Fatalf("Default subscription was not switched. Got: %+v", subs)
+	}
+
+	if info, err := os.Stat(c.azureProfile); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("File mode was not preserved: %v, %v", info.Mode(), err)
+	}
+	clouds, err := readINI(filepath.Join(tempDir, "clouds.config"))
+	if err != nil || clouds["AzureCloud"]["subscription"] != "sub-b" {
+		t.Fatalf("Expected clouds.config to name the subscription as the profile does, got: %v, %v", clouds, err)
+	}
+	if _, err := os.Stat(c.azureProfile + ".lockfile"); !os.IsNotExist(err) {
+		t.Fatalf("Lock file was not removed: %v", err)
+	}
+}
+
+func TestSetDefaultSubscriptionUnfamiliar(t *testing.T) {
+	profiles := map[string]string{
+		"not json":         `subscriptions`,
+		"no subscriptions": `{"installationId": "abc"}`,
+		"no isDefault":     `{"subscriptions": [{"id": "sub-a"}]}`,
+		"unknown id":       `{"subscriptions": [{"id": "sub-a", "isDefault": true}]}`,
+		"listed twice":     `{"subscriptions": [{"id": "sub-b", "isDefault": true}, {"id": "sub-b", "isDefault": false}]}`,
+	}
+	for name, profile := range profiles {
+		if _, _, err := setDefaultSubscription([]byte(profile), "sub-b"); !errors.Is(err, errUnfamiliarProfile) {
+			t.Fatalf("%s: expected errUnfamiliarProfile, got: %v", name, err)
+		}
+	}
+}
+
+func TestSwitchSubscriptionReportsErrors(t *testing.T) {
+	c := testConfig(t, "")
+	// A profile that cannot be read is an error, not a reason to use the CLI.
+	if err := os.Mkdir(c.azureProfile, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	err := c.switchSubscription(context.Background(), "sub-a", "")
+	if err == nil || !strings.Contains(err.Error(), "unable to read") {
+		t.Fatalf("Expected the read error, got: %v", err)
+	}
+}
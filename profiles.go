@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+const profileUsage = `Usage: az-wrap profile <command> [arguments]
+
+Commands:
+  ls                 List az profiles
+  add <name> <dir>   Add or update an az profile pointing at an Azure config directory
+  rm <name>          Remove an az profile, the config directory is left untouched
+
+Use an az profile with 'az-wrap -profile <name>'.`
+
+// defaultProfile is the name shown for the config directory the Azure CLI
+// itself would use.
+const defaultProfile = "default"
+
+// azureConfigDir resolves the Azure config directory the same way the Azure
+// CLI does: AZURE_CONFIG_DIR when set, otherwise ~/.azure.
+func azureConfigDir(homeDir string) string {
+	dir := os.Getenv("AZURE_CONFIG_DIR")
+	if dir == "" {
+		return filepath.Join(homeDir, ".azure")
+	}
+	return expandHome(dir, homeDir)
+}
+
+// expandHome replaces a leading ~ with the home directory.
+func expandHome(path, homeDir string) string {
+	if path == "~" {
+		return homeDir
+	}
+	if strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		return filepath.Join(homeDir, path[2:])
+	}
+	return path
+}
+
+// setAzureDir points the config at another Azure config directory.
+func (c *config) setAzureDir(dir string) {
+	c.azureDir = dir
+	c.azureProfile = filepath.Join(dir, "azureProfile.json")
+}
+
+// useProfile switches to the Azure config directory of a named az profile.
+func (c *config) useProfile(name string) error {
+	profiles, err := c.loadProfiles()
+	if err != nil {
+		return err
+	}
+	dir, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("az profile '%s' not found, see 'az-wrap profile ls'", name)
+	}
+	c.setAzureDir(dir)
+	c.profile = name
+	return nil
+}
+
+// describeConfigDir names the active Azure config directory for display.
+func (c *config) describeConfigDir() string {
+	if c.profile == "" {
+		return c.azureDir
+	}
+	return fmt.Sprintf("%s (%s)", c.profile, c.azureDir)
+}
+
+// loadProfiles reads the az profiles, a map of name to Azure config directory.
+func (c *config) loadProfiles() (map[string]string, error) {
+	var f struct {
+		Profiles map[string]string `json:"profiles"`
+	}
+	data, err := os.ReadFile(c.profilesFile)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read az profiles: %w", err)
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("unable to parse az profiles: %w", err)
+	}
+	if f.Profiles == nil {
+		f.Profiles = map[string]string{}
+	}
+	return f.Profiles, nil
+}
+
+func (c *config) saveProfiles(profiles map[string]string) error {
+	data, err := json.MarshalIndent(struct {
+		Profiles map[string]string `json:"profiles"`
+	}{profiles}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode az profiles: %w", err)
+	}
+	if err := writeFileAtomic(c.profilesFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("unable to write az profiles: %w", err)
+	}
+	return nil
+}
+
+// runProfileCommand handles the "profile" subcommand.
+func runProfileCommand(cfg *config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf(profileUsage)
+	}
+
+	profiles, err := cfg.loadProfiles()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "ls", "list":
+		return listProfiles(cfg, profiles)
+	case "add":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: az-wrap profile add <name> <dir>")
+		}
+		name := args[1]
+		if name == defaultProfile {
+			return fmt.Errorf("'%s' is reserved for the Azure CLI's own config directory", defaultProfile)
+		}
+		dir, err := filepath.Abs(expandHome(args[2], cfg.homeDir))
+		if err != nil {
+			return fmt.Errorf("invalid config directory: %w", err)
+		}
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			return fmt.Errorf("'%s' is not a directory", dir)
+		}
+		profiles[name] = dir
+		if err := cfg.saveProfiles(profiles); err != nil {
+			return err
+		}
+		fmt.Printf("az profile '%s' uses %s.\n", name, dir)
+		fmt.Printf("Log in to it with: AZURE_CONFIG_DIR=%s az login\n", dir)
+		return nil
+	case "rm", "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: az-wrap profile rm <name>")
+		}
+		if _, ok := profiles[args[1]]; !ok {
+			return fmt.Errorf("az profile '%s' not found", args[1])
+		}
+		delete(profiles, args[1])
+		if err := cfg.saveProfiles(profiles); err != nil {
+			return err
+		}
+		fmt.Printf("az profile '%s' removed.\n", args[1])
+		return nil
+	default:
+		return fmt.Errorf("unknown profile command '%s'\n\n%s", args[0], profileUsage)
+	}
+}
+
+// listProfiles prints the az profiles with the subscriptions logged in to
+// each, marking the active one.
+func listProfiles(cfg *config, profiles map[string]string) error {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = append([]string{defaultProfile}, names...)
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("Profile", "Config dir", "Subscriptions", "Default subscription")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWidthFunc(visibleWidth)
+	for _, name := range names {
+		dir := azureConfigDir(cfg.homeDir)
+		if name != defaultProfile {
+			dir = profiles[name]
+		}
+
+		count, current := "not logged in", ""
+		probe := *cfg
+		probe.setAzureDir(dir)
+		if subs, err := probe.getSubscriptionsFromFile(); err == nil {
+			count = fmt.Sprint(len(subs))
+			for _, s := range subs {
+				if s.Selected {
+					current = s.Name
+				}
+			}
+		}
+
+		label := name
+		if (name == defaultProfile && cfg.profile == "") || name == cfg.profile {
+			label = color.New(color.BgBlue, color.FgWhite).Sprint(name)
+		}
+		tbl.AddRow(label, dir, count, current)
+	}
+	tbl.Print()
+	return nil
+}
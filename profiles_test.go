@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAzureConfigDir(t *testing.T) {
+	homeDir := t.TempDir()
+
+	t.Setenv("AZURE_CONFIG_DIR", "")
+	if dir := azureConfigDir(homeDir); dir != filepath.Join(homeDir, ".azure") {
+		t.Fatalf("Expected default config dir, got: %s", dir)
+	}
+
+	t.Setenv("AZURE_CONFIG_DIR", "~/customer-a")
+	if dir := azureConfigDir(homeDir); dir != filepath.Join(homeDir, "customer-a") {
+		t.Fatalf("Expected expanded AZURE_CONFIG_DIR, got: %s", dir)
+	}
+
+	t.Setenv("AZURE_CONFIG_DIR", "/srv/azure")
+	c, err := newConfig()
+	if err != nil {
+		t.Fatalf("Failed to create new config: %v", err)
+	}
+	if c.azureProfile != filepath.Join("/srv/azure", "azureProfile.json") {
+		t.Fatalf("Expected profile inside AZURE_CONFIG_DIR, got: %s", c.azureProfile)
+	}
+}
+
+func TestUseProfile(t *testing.T) {
+	c := testConfig(t, "")
+	tempDir := t.TempDir()
+
+	customerDir := filepath.Join(tempDir, "customer-a")
+	if err := c.saveProfiles(map[string]string{"customer-a": customerDir}); err != nil {
+		t.Fatalf("Failed to save profiles: %v", err)
+	}
+
+	if err := c.useProfile("customer-a"); err != nil {
+		t.Fatalf("Failed to use profile: %v", err)
+	}
+	if c.azureProfile != filepath.Join(customerDir, "azureProfile.json") || c.profile != "customer-a" {
+		t.Fatalf("Profile was not applied. Got: %s, %s", c.profile, c.azureProfile)
+	}
+	if err := c.useProfile("missing"); err == nil {
+		t.Fatalf("Expected error for unknown profile, got none")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const promptUsage = `Usage: az-wrap prompt [-format <format>] [-color ansi|bash|zsh|tmux|none]
+
+Prints the active subscription for a shell prompt or status line. The format
+may use {alias}, {name}, {id}, {tenant} and {cloud}, and defaults to {alias}.
+The text has the color of the alias, production subscriptions are red.
+
+  bash      PS1='$(az-wrap prompt -color bash) \w \$ '
+  zsh       setopt prompt_subst; PROMPT='$(az-wrap prompt -color zsh) %~ %# '
+  tmux      set -g status-right '#(az-wrap prompt -color tmux)'
+  starship  [custom.azure] command = "az-wrap prompt", when = true`
+
+// productionWords mark a subscription as production when they are one of its
+// tags, or a word of its name or aliases.
+var productionWords = []string{"prod", "prd", "production"}
+
+// nonProductionPrefixes negate a production word they come before, as in
+// non-prod and pre-prod.
+var nonProductionPrefixes = []string{"non", "pre"}
+
+// promptCache is the last prompt printed for an Azure config directory,
+// together with the state of the files it was computed from.
+type promptCache struct {
+	Key    string `json:"key"`
+	Output string `json:"output"`
+}
+
+// isProduction reports whether a subscription looks like production.
+func isProduction(s subscriptionAlias) bool {
+	for _, tag := range s.Tags {
+		if slices.Contains(productionWords, strings.ToLower(tag)) {
+			return true
+		}
+	}
+	for _, text := range append([]string{s.Name}, s.Aliases...) {
+		words := tokens(strings.ToLower(text))
+		for i, word := range words {
+			if slices.Contains(productionWords, word) && (i == 0 || !slices.Contains(nonProductionPrefixes, words[i-1])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// activeSubscription returns the default subscription of azureProfile.json
+// with its aliases. It never starts the Azure CLI. It returns nil when no
+// subscription is selected.
+func (c *config) activeSubscription() (*subscriptionAlias, error) {
+	subs, err := c.getSubscriptionsFromFile()
+	if err != nil {
+		return nil, err
+	}
+	for i, sub := range subs {
+		if !sub.Selected {
+			continue
+		}
+		store, err := c.loadMergedAliasStore()
+		if err != nil {
+			return nil, err
+		}
+		s := subscriptionAlias{Name: sub.Name, ID: sub.ID, Index: i + 1, Selected: true, TenantID: sub.TenantID, Cloud: sub.EnvironmentName}
+		if s.Cloud == "" {
+			s.Cloud = sub.CloudName
+		}
+		if meta := store.Subscriptions[sub.ID]; meta != nil {
+			s.Alias, s.Aliases, s.Tags, s.Color = meta.primary(), meta.Aliases, meta.Tags, meta.Color
+		}
+		s.TenantAlias = store.primaryTenantAlias(sub.TenantID)
+		return &s, nil
+	}
+	return nil, nil
+}
+
+// formatPrompt fills in the tokens of format and colors the result.
+func formatPrompt(s subscriptionAlias, format, style string) string {
+	alias := s.Alias
+	if alias == "" {
+		alias = s.Name
+	}
+	tenant := s.TenantAlias
+	if tenant == "" {
+		tenant = s.TenantID
+	}
+	text := strings.NewReplacer(
+		"{alias}", alias,
+		"{name}", s.Name,
+		"{id}", s.ID,
+		"{tenant}", tenant,
+		"{cloud}", s.Cloud,
+	).Replace(format)
+
+	// Production is always red, whatever the color of its alias.
+	colorName, bold := s.Color, false
+	if isProduction(s) {
+		colorName, bold = "red", true
+	}
+
+	switch style {
+	case "zsh":
+		text = strings.ReplaceAll(text, "%", "%%")
+	case "tmux":
+		text = strings.ReplaceAll(text, "#", "##")
+	}
+	attr, ok := aliasColors[colorName]
+	if !ok || style == "none" {
+		return text
+	}
+
+	if style == "tmux" {
+		if bold {
+			return fmt.Sprintf("#[fg=%s,bold]%s#[default]", colorName, text)
+		}
+		return fmt.Sprintf("#[fg=%s]%s#[default]", colorName, text)
+	}
+	start, end := fmt.Sprintf("\x1b[%dm", attr), "\x1b[0m"
+	if bold {
+		start = fmt.Sprintf("\x1b[1;%dm", attr)
+	}
+	switch style {
+	case "bash":
+		// Readline must not count the escape sequences as visible.
+		start, end = "\x01"+start+"\x02", "\x01"+end+"\x02"
+	case "zsh":
+		start, end = "%{"+start+"%}", "%{"+end+"%}"
+	}
+	return start + text + end
+}
+
+// promptCacheKey describes the files the prompt is computed from, so a
+// cached prompt is used until one of them changes.
+func (c *config) promptCacheKey() string {
+	files := []string{c.azureProfile, c.storeFile, c.aliasFile}
+	for _, src := range c.sharedStoreFiles {
+		files = append(files, src.Path)
+	}
+	var sb strings.Builder
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			fmt.Fprintf(&sb, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&sb, "%s:-;", name)
+		}
+	}
+	return sb.String()
+}
+
+// runPromptCommand prints the active subscription for a prompt. A prompt
+// must never fail, so without an active subscription it prints nothing.
+func runPromptCommand(cfg *config, args []string) error {
+	fs := flag.NewFlagSet("prompt", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), promptUsage) }
+	format := fs.String("format", "{alias}", "Text to print, with {alias}, {name}, {id}, {tenant} and {cloud}")
+	style := fs.String("color", "ansi", "Color escapes: ansi, bash, zsh, tmux or none")
+	if rest := parseArgs(fs, args); len(rest) > 0 {
+		return errors.New(promptUsage)
+	}
+	switch *style {
+	case "ansi", "bash", "zsh", "tmux", "none":
+	default:
+		return fmt.Errorf("unknown color style '%s', use ansi, bash, zsh, tmux or none", *style)
+	}
+	if *style == "ansi" && os.Getenv("NO_COLOR") != "" {
+		*style = "none"
+	}
+
+	// Every Azure config directory, format and style has its own cache.
+	sum := sha256.Sum256([]byte(strings.Join([]string{cfg.azureDir, *format, *style}, "\x00")))
+	file := filepath.Join(cfg.stateDir, "cache", "prompt-"+hex.EncodeToString(sum[:6])+".json")
+	key := cfg.promptCacheKey()
+	var cache promptCache
+	if data, err := os.ReadFile(file); err == nil && json.Unmarshal(data, &cache) == nil && cache.Key == key {
+		printPrompt(cache.Output)
+		return nil
+	}
+
+	s, err := cfg.activeSubscription()
+	if err != nil || s == nil {
+		return nil
+	}
+	output := formatPrompt(*s, *format, *style)
+	if data, err := json.Marshal(promptCache{Key: key, Output: output}); err == nil {
+		writeFileAtomic(file, data, 0600)
+	}
+	printPrompt(output)
+	return nil
+}
+
+func printPrompt(output string) {
+	if output != "" {
+		fmt.Println(output)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIsProduction(t *testing.T) {
+	tests := []struct {
+		s        subscriptionAlias
+		expected bool
+	}{
+		{subscriptionAlias{Name: "corp-0042-weu-prod-payments"}, true},
+		{subscriptionAlias{Name: "payments", Aliases: []string{"pay:prd"}}, true},
+		{subscriptionAlias{Name: "payments", Tags: []string{"Production"}}, true},
+		{subscriptionAlias{Name: "products-dev"}, false},
+		{subscriptionAlias{Name: "payments", Aliases: []string{"pay:preprod"}}, false},
+		{subscriptionAlias{Name: "corp-non-prod"}, false},
+		{subscriptionAlias{Name: "payments-pre-prod"}, false},
+		{subscriptionAlias{Name: "prod-payments"}, true},
+	}
+	for _, test := range tests {
+		if got := isProduction(test.s); got != test.expected {
+			t.Errorf("Expected %v for %+v, got: %v", test.expected, test.s, got)
+		}
+	}
+}
+
+func TestFormatPrompt(t *testing.T) {
+	s := subscriptionAlias{Name: "payments-dev", ID: testSubB, TenantID: "tenant-id", Cloud: "AzureCloud"}
+	if got := formatPrompt(s, "{alias}@{tenant} ({cloud})", "ansi"); got != "payments-dev@tenant-id (AzureCloud)" {
+		t.Errorf("Expected the name without an alias, got: %q", got)
+	}
+
+	s.Alias, s.TenantAlias, s.Color = "pay:dev", "contoso", "green"
+	if got := formatPrompt(s, "{alias}@{tenant}", "ansi"); got != "\x1b[32mpay:dev@contoso\x1b[0m" {
+		t.Errorf("Expected the alias in green, got: %q", got)
+	}
+	if got := formatPrompt(s, "{alias}", "none"); got != "pay:dev" {
+		t.Errorf("Expected no color, got: %q", got)
+	}
+
+	s.Name, s.Alias, s.Color = "payments-prod", "100%", ""
+	if got := formatPrompt(s, "{alias}", "zsh"); got != "%{\x1b[1;31m%}100%%%{\x1b[0m%}" {
+		t.Errorf("Expected production in escaped red, got: %q", got)
+	}
+	if got := formatPrompt(s, "{alias}", "tmux"); got != "#[fg=red,bold]100%#[default]" {
+		t.Errorf("Expected production in red for tmux, got: %q", got)
+	}
+	if got := formatPrompt(s, "{alias}", "bash"); got != "\x01\x1b[1;31m\x02100%\x01\x1b[0m\x02" {
+		t.Errorf("Expected production in red for bash, got: %q", got)
+	}
+	s.Color = "green"
+	if got := formatPrompt(s, "{alias}", "ansi"); got != "\x1b[1;31m100%\x1b[0m" {
+		t.Errorf("Expected production in red over the alias color, got: %q", got)
+	}
+}
+
+func TestActiveSubscription(t *testing.T) {
+	c := testConfig(t, `{"subscriptions": [
+		{"name": "payments-prod", "id": "`+testSubA+`", "isDefault": false},
+		{"name": "payments-dev", "id": "`+testSubB+`", "isDefault": true, "environmentName": "AzureCloud"}
+	]}`)
+	key := c.promptCacheKey()
+
+	if err := c.saveAliasFile(testSubB, "pay:dev"); err != nil {
+		t.Fatalf("Failed to save alias: %v", err)
+	}
+	s, err := c.activeSubscription()
+	if err != nil || s == nil {
+		t.Fatalf("Failed to get the active subscription: %v", err)
+	}
+	if s.ID != testSubB || s.Alias != "pay:dev" || s.Cloud != "AzureCloud" {
+		t.Errorf("Expected payments-dev with its alias, got: %+v", s)
+	}
+	if c.promptCacheKey() == key {
+		t.Errorf("Expected the cache key to change with the alias store")
+	}
+
+	c.setAzureDir(t.TempDir())
+	if _, err := c.activeSubscription(); err == nil {
+		t.Errorf("Expected error without a profile, got none")
+	}
+}
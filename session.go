@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// sessionCopies are the files of an Azure config directory a session gets its
+// own copy of. The profile and configs hold the default subscription and the
+// active cloud. MSAL locks the token cache through a lock file next to it,
+// which a link would not share, so the session refreshes its own copy.
+// Everything else is linked to the original.
+var sessionCopies = map[string]bool{
+	"azureProfile.json":     true,
+	"config":                true,
+	"clouds.config":         true,
+	"msal_token_cache.json": true,
+	"msal_token_cache.bin":  true,
+}
+
+// sessionTTL is how long a session directory may go unused before it is
+// removed. 'shell -env' cannot tell when its shell exits, so its directories
+// are pruned when a later session is created.
+const sessionTTL = 7 * 24 * time.Hour
+
+// cloneAzureDir fills dir with a private copy of the Azure config directory
+// src, sharing the login through symlinks. Where symlinks are not allowed
+// files are copied instead.
+func cloneAzureDir(src, dir string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %w", src, err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("unable to create session directory: %w", err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".lockfile") {
+			continue
+		}
+		from, to := filepath.Join(src, name), filepath.Join(dir, name)
+		if err := os.RemoveAll(to); err != nil {
+			return err
+		}
+		if sessionCopies[name] {
+			if err := copyFile(from, to); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Symlink(from, to); err != nil {
+			if e.IsDir() {
+				continue
+			}
+			if err := copyFile(from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("unable to copy %s: %w", from, err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("unable to copy %s: %w", from, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("unable to copy %s: %w", from, err)
+	}
+	return out.Close()
+}
+
+// pruneSessions removes the session directories in sessions that were not
+// used for sessionTTL, except keep.
+func pruneSessions(sessions, keep string) {
+	entries, err := os.ReadDir(sessions)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		dir := filepath.Join(sessions, e.Name())
+		if dir == keep {
+			continue
+		}
+		if info, err := e.Info(); err == nil && time.Since(info.ModTime()) > sessionTTL {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+// newSession clones the active Azure config directory into dir and makes the
+// subscription its default. The returned config uses the session directory.
+func (c *config) newSession(ctx context.Context, dir string, s subscriptionAlias) (*config, error) {
+	pruneSessions(filepath.Dir(dir), dir)
+	if err := cloneAzureDir(c.azureDir, dir); err != nil {
+		return nil, err
+	}
+	session := *c
+	session.setAzureDir(dir)
+	if err := session.switchSubscription(ctx, s.ID, s.Cloud); err != nil {
+		return nil, &azureError{err}
+	}
+	return &session, nil
+}
+
+// tempSession creates a session in a new temporary directory, which the
+// caller removes when done.
+func (c *config) tempSession(ctx context.Context, s subscriptionAlias) (string, error) {
+	sessions := filepath.Join(c.stateDir, "sessions")
+	if err := os.MkdirAll(sessions, 0700); err != nil {
+		return "", fmt.Errorf("unable to create session directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(sessions, "session-")
+	if err != nil {
+		return "", fmt.Errorf("unable to create session directory: %w", err)
+	}
+	if _, err := c.newSession(ctx, dir, s); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// sessionDir is the session directory printed by 'shell -env'. It is reused
+// for the same Azure config directory and subscription, and removed by
+// pruneSessions once unused.
+func (c *config) sessionDir(subscriptionId string) string {
+	sum := sha256.Sum256([]byte(c.azureDir))
+	return filepath.Join(c.stateDir, "sessions", fmt.Sprintf("%s-%s", strings.ToLower(subscriptionId), hex.EncodeToString(sum[:4])))
+}
+
+// userShell returns the shell to start for a session.
+func userShell() string {
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh
+	}
+	if runtime.GOOS == "windows" {
+		if sh, err := exec.LookPath("pwsh"); err == nil {
+			return sh
+		}
+		if sh := os.Getenv("COMSPEC"); sh != "" {
+			return sh
+		}
+	}
+	return "/bin/sh"
+}
+
+// sessionLabel names the subscription of a session for the AZ_WRAP_SESSION
+// variable.
+func sessionLabel(s subscriptionAlias) string {
+	if len(s.Aliases) > 0 {
+		return s.Aliases[0]
+	}
+	return s.Name
+}
+
+// runShellCommand starts a shell, or prints the environment for one, in which
+// the Azure CLI uses the subscription without changing the global default.
+func runShellCommand(ctx context.Context, cfg *config, opts options, args []string) error {
+	fs := flag.NewFlagSet("shell", flag.ExitOnError)
+	env := fs.Bool("env", false, "Print the environment for eval instead of starting a shell")
+	shellName := fs.String("shell", "", "Shell syntax for -env: sh, fish or pwsh (default from $SHELL)")
+	rest := parseArgs(fs, args)
+	if len(rest) != 1 {
+		return fmt.Errorf("usage: az-wrap shell <subscription> [-env] [-shell sh|fish|pwsh]")
+	}
+
+	aliases, err := selectableSubscriptions(cfg, opts)
+	if err != nil {
+		return err
+	}
+	s, err := resolveSubscription(aliases, rest[0])
+	if err != nil {
+		return err
+	}
+
+	if *env {
+		session, err := cfg.newSession(ctx, cfg.sessionDir(s.ID), s)
+		if err != nil {
+			return err
+		}
+		shell := *shellName
+		if shell == "" {
+			shell = strings.TrimSuffix(filepath.Base(userShell()), ".exe")
+		}
+		printSessionEnv(os.Stdout, shell, session.azureDir, sessionLabel(s))
+		return nil
+	}
+
+	dir, err := cfg.tempSession(ctx, s)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	fmt.Printf("Starting a shell for %s (%s). Exit it to return.\n", s.Name, s.ID)
+	cmd := exec.Command(userShell())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), "AZURE_CONFIG_DIR="+dir, "AZ_WRAP_SESSION="+sessionLabel(s))
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// The shell reported the exit code of its last command, which is
+		// not an error of az-wrap.
+		return nil
+	}
+	return err
+}
+
+// printSessionEnv prints the session variables in the syntax of a shell.
+func printSessionEnv(w io.Writer, shell, dir, label string) {
+	for _, v := range [][2]string{{"AZURE_CONFIG_DIR", dir}, {"AZ_WRAP_SESSION", label}} {
+		switch shell {
+		case "fish":
+			fmt.Fprintf(w, "set -gx %s %s;\n", v[0], quoteArg(shell, v[1]))
+		case "pwsh", "powershell":
+			fmt.Fprintf(w, "$env:%s = %s\n", v[0], quoteArg("pwsh", v[1]))
+		default:
+			fmt.Fprintf(w, "export %s=%s\n", v[0], quoteArg(shell, v[1]))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewSession(t *testing.T) {
+	c := testConfig(t, "")
+
+	profile := `{"subscriptions": [
+		{"name": "prod", "id": "` + testSubA + `", "isDefault": true},
+		{"name": "dev", "id": "` + testSubB + `", "isDefault": false}
+	]}`
+	files := map[string]string{
+		"azureProfile.json":          profile,
+		"msal_token_cache.json":      `{"AccessToken": {}}`,
+		"commandIndex.json":          "{}",
+		"azureProfile.json.lockfile": "1",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(c.azureDir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	dir := c.sessionDir(testSubB)
+	session, err := c.newSession(context.Background(), dir, subscriptionAlias{ID: testSubB})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if session.azureDir != dir || session.defaultSubscriptionID() != testSubB {
+		t.Fatalf("Expected dev to be the session default in %s, got %s in %s", dir, session.defaultSubscriptionID(), session.azureDir)
+	}
+	if c.defaultSubscriptionID() != testSubA {
+		t.Fatalf("Expected the global default to stay prod, got %s", c.defaultSubscriptionID())
+	}
+
+	if info, err := os.Lstat(filepath.Join(dir, "msal_token_cache.json")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("Expected the token cache to be copied, got: %v", err)
+	}
+	if info, err := os.Lstat(filepath.Join(dir, "commandIndex.json")); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected other files to be linked, got: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "azureProfile.json.lockfile")); !os.IsNotExist(err) {
+		t.Errorf("Expected lock files not to be cloned, got: %v", err)
+	}
+
+	// A session can be recreated in place.
+	if _, err := c.newSession(context.Background(), dir, subscriptionAlias{ID: testSubA}); err != nil {
+		t.Fatalf("Failed to recreate session: %v", err)
+	}
+
+	// Sessions unused for too long are removed when another is created.
+	old := time.Now().Add(-2 * sessionTTL)
+	if err := os.Chtimes(dir, old, old); err != nil {
+		t.Fatalf("Failed to age session: %v", err)
+	}
+	if _, err := c.newSession(context.Background(), c.sessionDir(testSubA), subscriptionAlias{ID: testSubA}); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the unused session to be removed, got: %v", err)
+	}
+}
+
+func TestPrintSessionEnv(t *testing.T) {
+	tests := map[string]string{
+		"bash": "export AZURE_CONFIG_DIR='/s'\nexport AZ_WRAP_SESSION='dev'\n",
+		"fish": "set -gx AZURE_CONFIG_DIR '/s';\nset -gx AZ_WRAP_SESSION 'dev';\n",
+		"pwsh": "$env:AZURE_CONFIG_DIR = '/s'\n$env:AZ_WRAP_SESSION = 'dev'\n",
+	}
+	for shell, want := range tests {
+		var buf bytes.Buffer
+		printSessionEnv(&buf, shell, "/s", "dev")
+		if buf.String() != want {
+			t.Errorf("Unexpected %s environment:\n%s", shell, buf.String())
+		}
+	}
+}
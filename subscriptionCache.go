@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+const defaultCacheTTL = time.Hour
+
+// subscriptionCache is the on-disk cache of a subscription source.
+type subscriptionCache struct {
+	FetchedAt     time.Time             `json:"fetchedAt"`
+	Subscriptions []loadedSubscriptions `json:"subscriptions"`
+}
+
+// cachedSource serves the last successful result of a slow source from disk.
+// Results older than ttl are still served, but refreshed in the background
+// for the next run.
+type cachedSource struct {
+	c     *config
+	inner SubscriptionSource
+	file  string
+	ttl   time.Duration
+	// refreshLater starts the background refresh of a stale cache.
+	refreshLater func() error
+}
+
+func newCachedSource(c *config, inner SubscriptionSource) cachedSource {
+	// Every Azure config directory has its own subscriptions.
+	sum := sha256.Sum256([]byte(c.azureDir))
+	name := fmt.Sprintf("%s-%s.json", inner.Name(), hex.EncodeToString(sum[:6]))
+	s := cachedSource{
+		c:     c,
+		inner: inner,
+		file:  filepath.Join(c.stateDir, "cache", name),
+		ttl:   c.cacheTTL,
+	}
+	s.refreshLater = s.startRefresh
+	return s
+}
+
+func (s cachedSource) Name() string { return s.inner.Name() }
+
+func (s cachedSource) Subscriptions(ctx context.Context) ([]loadedSubscriptions, error) {
+	cache, err := s.read()
+	if s.c.refresh || err != nil {
+		return s.load(ctx)
+	}
+
+	s.c.cachedAt = cache.FetchedAt
+	if time.Since(cache.FetchedAt) > s.ttl {
+		s.c.cacheStale = true
+		// A failed refresh only means the stale list is served again.
+		s.refreshLater()
+	}
+	return cache.Subscriptions, nil
+}
+
+// startRefresh refreshes the cache in a separate 'az-wrap __refresh-cache'
+// process, which outlives this one. A goroutine would be killed when
+// az-wrap exits, long before az has answered.
+func (s cachedSource) startRefresh() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "__refresh-cache")
+	// The child finds the same cache through the Azure config directory.
+	cmd.Env = append(os.Environ(), "AZURE_CONFIG_DIR="+s.c.azureDir)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// runRefreshCacheCommand refreshes the cached CLI subscriptions, see
+// startRefresh. It does nothing while another refresh is running.
+func runRefreshCacheCommand(ctx context.Context, cfg *config) error {
+	s := newCachedSource(cfg, cliSource{cfg})
+	if err := os.MkdirAll(filepath.Dir(s.file), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(s.file+".lock", 0)
+	if err != nil {
+		return nil
+	}
+	defer unlock()
+	_, err = s.load(ctx)
+	return err
+}
+
+// load fetches fresh subscriptions from the inner source and caches them.
+func (s cachedSource) load(ctx context.Context) ([]loadedSubscriptions, error) {
+	subs, err := s.inner.Subscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(subscriptionCache{FetchedAt: time.Now(), Subscriptions: subs})
+	if err == nil {
+		// A failing cache must never fail the listing.
+		writeFileAtomic(s.file, data, 0600)
+	}
+	return subs, nil
+}
+
+func (s cachedSource) read() (*subscriptionCache, error) {
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return nil, err
+	}
+	var cache subscriptionCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	if len(cache.Subscriptions) == 0 {
+		return nil, fmt.Errorf("empty subscription cache")
+	}
+	return &cache, nil
+}
+
+// cacheTTLFromEnv reads the cache lifetime from AZ_WRAP_CACHE_TTL, such as
+// "30m" or "24h".
+func cacheTTLFromEnv() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("AZ_WRAP_CACHE_TTL")); err == nil {
+		return ttl
+	}
+	return defaultCacheTTL
+}
+
+// cacheMarker describes the age of a cached subscription list.
+func cacheMarker(cachedAt time.Time, stale bool) string {
+	asOf := cachedAt.Local().Format("2006-01-02 15:04")
+	if stale {
+		return fmt.Sprintf("Stale as of %s, refreshing in the background. Use -refresh to reload now.", asOf)
+	}
+	return fmt.Sprintf("Cached as of %s. Use -refresh to reload now.", asOf)
+}
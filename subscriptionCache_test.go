@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// signalSource reports every call on called.
+type signalSource struct {
+	subs   []loadedSubscriptions
+	called chan struct{}
+}
+
+func (s signalSource) Name() string { return "cli" }
+
+func (s signalSource) Subscriptions(ctx context.Context) ([]loadedSubscriptions, error) {
+	s.called <- struct{}{}
+	return s.subs, nil
+}
+
+func writeTestCache(t *testing.T, s cachedSource, fetchedAt time.Time, subs []loadedSubscriptions) {
+	data, _ := json.Marshal(subscriptionCache{FetchedAt: fetchedAt, Subscriptions: subs})
+	if err := os.MkdirAll(filepath.Dir(s.file), 0755); err != nil {
+		t.Fatalf("Failed to create cache dir: %v", err)
+	}
+	if err := os.WriteFile(s.file, data, 0600); err != nil {
+		t.Fatalf("Failed to write cache: %v", err)
+	}
+}
+
+func TestCachedSource(t *testing.T) {
+	c := testConfig(t, "")
+	c.cacheTTL = time.Hour
+
+	cached := []loadedSubscriptions{{ID: "sub-cached"}}
+	fresh := []loadedSubscriptions{{ID: "sub-fresh"}}
+	inner := signalSource{subs: fresh, called: make(chan struct{}, 1)}
+
+	// Without a cache the source is loaded and the result cached.
+	s := newCachedSource(c, inner)
+	subs, err := s.Subscriptions(context.Background())
+	if err != nil || subs[0].ID != "sub-fresh" {
+		t.Fatalf("Expected a synchronous load, got: %v, %v", subs, err)
+	}
+	<-inner.called
+	if cache, err := s.read(); err != nil || cache.Subscriptions[0].ID != "sub-fresh" {
+		t.Fatalf("Expected the result to be cached, got: %v, %v", cache, err)
+	}
+
+	// A fresh cache is served without calling the source.
+	writeTestCache(t, s, time.Now(), cached)
+	subs, err = s.Subscriptions(context.Background())
+	if err != nil || subs[0].ID != "sub-cached" {
+		t.Fatalf("Expected the cached subscriptions, got: %v, %v", subs, err)
+	}
+	if c.cachedAt.IsZero() || c.cacheStale {
+		t.Errorf("Expected a fresh cache to be reported, got cachedAt %v, stale %v", c.cachedAt, c.cacheStale)
+	}
+	select {
+	case <-inner.called:
+		t.Errorf("Expected no load for a fresh cache")
+	default:
+	}
+
+	// A stale cache is served and refreshed in the background.
+	refreshed := false
+	s.refreshLater = func() error {
+		refreshed = true
+		return nil
+	}
+	writeTestCache(t, s, time.Now().Add(-2*time.Hour), cached)
+	subs, err = s.Subscriptions(context.Background())
+	if err != nil || subs[0].ID != "sub-cached" {
+		t.Fatalf("Expected the stale subscriptions, got: %v, %v", subs, err)
+	}
+	if !c.cacheStale || !refreshed {
+		t.Errorf("Expected the cache to be reported stale and refreshed, got stale %v, refreshed %v", c.cacheStale, refreshed)
+	}
+	select {
+	case <-inner.called:
+		t.Errorf("Expected no load while serving a stale cache")
+	default:
+	}
+
+	// -refresh always loads synchronously.
+	c.refresh = true
+	subs, err = s.Subscriptions(context.Background())
+	if err != nil || subs[0].ID != "sub-fresh" {
+		t.Fatalf("Expected a synchronous load with refresh, got: %v, %v", subs, err)
+	}
+	<-inner.called
+}
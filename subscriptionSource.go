@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// SubscriptionSource loads the subscriptions the user has access to.
+type SubscriptionSource interface {
+	// Name identifies the source in AZ_WRAP_SOURCES and error messages.
+	Name() string
+	Subscriptions(ctx context.Context) ([]loadedSubscriptions, error)
+}
+
+// defaultSources is the default order of subscription sources. The profile
+// file is preferred over the Azure CLI as it loads ~ 90% quicker.
+var defaultSources = []string{"file", "cli"}
+
+const defaultARMEndpoint = "https://management.azure.com"
+
+// profileFileSource reads azureProfile.json.
+type profileFileSource struct{ c *config }
+
+func (s profileFileSource) Name() string { return "file" }
+
+func (s profileFileSource) Subscriptions(ctx context.Context) ([]loadedSubscriptions, error) {
+	return s.c.getSubscriptionsFromFile()
+}
+
+// cliSource runs az account list.
+type cliSource struct{ c *config }
+
+func (s cliSource) Name() string { return "cli" }
+
+func (s cliSource) Subscriptions(ctx context.Context) ([]loadedSubscriptions, error) {
+	return s.c.getSubscriptionsWithCLI(ctx)
+}
+
+// armSource calls the Azure Resource Manager /subscriptions endpoint. Only
+// the subscriptions visible to the token's tenant are returned.
+type armSource struct {
+	c        *config
+	endpoint string
+	client   *http.Client
+	// token returns a bearer token for the endpoint.
+	token func(ctx context.Context) (string, error)
+}
+
+func newARMSource(c *config) armSource {
+	endpoint := c.armEndpoint
+	if endpoint == "" {
+		endpoint = c.cloudARMEndpoint(c.activeCloud())
+	}
+	s := armSource{c: c, endpoint: strings.TrimSuffix(endpoint, "/"), client: http.DefaultClient}
+	s.token = s.cliToken
+	return s
+}
+
+func (s armSource) Name() string { return "arm" }
+
+// armSubscription is a subscription as returned by the ARM REST API.
+type armSubscription struct {
+	SubscriptionID   string            `json:"subscriptionId"`
+	TenantID         string            `json:"tenantId"`
+	DisplayName      string            `json:"displayName"`
+	State            string            `json:"state"`
+	ManagedByTenants []managedByTenant `json:"managedByTenants"`
+}
+
+func (s armSource) Subscriptions(ctx context.Context) ([]loadedSubscriptions, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	token, err := s.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// ARM does not know the default subscription, so take it from the
+	// profile file when there is one.
+	var defaultID string
+	if subs, err := s.c.getSubscriptionsFromFile(); err == nil {
+		for _, sub := range subs {
+			if sub.Selected {
+				defaultID = sub.ID
+			}
+		}
+	}
+
+	cloud := s.c.activeCloud()
+	var subscriptions []loadedSubscriptions
+	next := s.endpoint + "/subscriptions?api-version=2022-12-01"
+	for next != "" {
+		var page struct {
+			Value    []armSubscription `json:"value"`
+			NextLink string            `json:"nextLink"`
+		}
+		if err := s.get(ctx, next, token, &page); err != nil {
+			return nil, err
+		}
+		for _, v := range page.Value {
+			subscriptions = append(subscriptions, loadedSubscriptions{
+				Name:             v.DisplayName,
+				ID:               v.SubscriptionID,
+				Selected:         strings.EqualFold(v.SubscriptionID, defaultID),
+				TenantID:         v.TenantID,
+				State:            v.State,
+				EnvironmentName:  cloud,
+				ManagedByTenants: v.ManagedByTenants,
+			})
+		}
+		next = page.NextLink
+	}
+
+	if len(subscriptions) == 0 {
+		return nil, fmt.Errorf("no subscriptions returned by %s", s.endpoint)
+	}
+	return subscriptions, nil
+}
+
+func (s armSource) get(ctx context.Context, url, token string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("unable to create ARM request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to call ARM: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read ARM response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ARM returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("unable to parse ARM response: %w", err)
+	}
+	return nil
+}
+
+// cliToken gets an access token for the endpoint from the Azure CLI.
+func (s armSource) cliToken(ctx context.Context) (string, error) {
+	cmd, err := s.c.azureCommand(ctx, "account", "get-access-token", "--resource", s.endpoint+"/", "--output", "json")
+	if err != nil {
+		return "", fmt.Errorf("unable to use the Azure CLI for getting an access token: %w", err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to get an access token, please login using 'az login': %w", err)
+	}
+
+	var token struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := json.Unmarshal(out, &token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("unable to parse the Azure CLI access token: %v", err)
+	}
+	return token.AccessToken, nil
+}
+
+// subscriptionSources returns the configured sources in the order they are tried.
+func (c *config) subscriptionSources() ([]SubscriptionSource, error) {
+	var sources []SubscriptionSource
+	for _, name := range c.sources {
+		switch name {
+		case "file":
+			sources = append(sources, profileFileSource{c})
+		case "cli":
+			sources = append(sources, newCachedSource(c, cliSource{c}))
+		case "arm":
+			sources = append(sources, newARMSource(c))
+		default:
+			return nil, fmt.Errorf("unknown subscription source '%s', use file, cli or arm", name)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no subscription sources configured")
+	}
+	return sources, nil
+}
+
+// loadFromSources tries every source in order and returns the first
+// successful result. If all fail, every error is returned.
+func loadFromSources(ctx context.Context, sources []SubscriptionSource) ([]loadedSubscriptions, error) {
+	var errs []error
+	for _, s := range sources {
+		subs, err := s.Subscriptions(ctx)
+		if err == nil {
+			return subs, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// sourcesFromEnv reads the source order from AZ_WRAP_SOURCES, a comma
+// separated list of file, cli and arm.
+func sourcesFromEnv() []string {
+	if env := splitList(strings.ToLower(os.Getenv("AZ_WRAP_SOURCES"))); len(env) > 0 {
+		return env
+	}
+	return defaultSources
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestARMSource(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"value": [{"subscriptionId": "sub-b", "displayName": "B", "state": "Disabled", "tenantId": "tenant-b"}]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"value": [{"subscriptionId": "sub-a", "displayName": "A", "state": "Enabled", "tenantId": "tenant-a", "managedByTenants": [{"tenantId": "tenant-m"}]}], "nextLink": "%s/subscriptions?page=2"}`, server.URL)
+	}))
+	defer server.Close()
+
+	c := testConfig(t, "")
+	c.armEndpoint = server.URL
+
+	src := newARMSource(c)
+	src.token = func(ctx context.Context) (string, error) { return "test-token", nil }
+
+	subs, err := src.Subscriptions(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list subscriptions from ARM: %v", err)
+	}
+	if len(subs) != 2 || subs[0].ID != "sub-a" || subs[0].ManagedByTenants[0].TenantID != "tenant-m" || subs[1].State != "Disabled" {
+		t.Fatalf("Subscription content mismatch. Got: %+v", subs)
+	}
+
+	src.token = func(ctx context.Context) (string, error) { return "wrong", nil }
+	if _, err := src.Subscriptions(context.Background()); err == nil {
+		t.Fatalf("Expected error for rejected token, got none")
+	}
+}
+
+type stubSource struct {
+	name string
+	subs []loadedSubscriptions
+	err  error
+}
+
+func (s stubSource) Name() string { return s.name }
+
+func (s stubSource) Subscriptions(ctx context.Context) ([]loadedSubscriptions, error) {
+	return s.subs, s.err
+}
+
+func TestLoadFromSources(t *testing.T) {
+	failing := stubSource{name: "first", err: errors.New("boom")}
+	working := stubSource{name: "second", subs: []loadedSubscriptions{{ID: "sub-a"}}}
+
+	subs, err := loadFromSources(context.Background(), []SubscriptionSource{failing, working})
+	if err != nil || len(subs) != 1 {
+		t.Fatalf("Expected fallback to the second source, got: %v, %v", subs, err)
+	}
+
+	_, err = loadFromSources(context.Background(), []SubscriptionSource{failing, failing})
+	if err == nil {
+		t.Fatalf("Expected error when every source fails, got none")
+	}
+
+	c, _ := newConfig()
+	c.sources = []string{"file", "bogus"}
+	if _, err := c.subscriptionSources(); err == nil {
+		t.Fatalf("Expected error for unknown source, got none")
+	}
+}
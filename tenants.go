@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+const tenantUsage = `Usage: az-wrap alias tenant <command> [arguments]
+
+Commands:
+  ls                      List tenants and their aliases
+  set <tenant> <alias>    Set or replace the primary alias of a tenant
+  rm <alias|tenant-id>    Remove a tenant alias, or all aliases of a tenant ID
+
+<tenant> can be a tenant ID or an existing tenant alias.`
+
+// primaryTenantAlias returns the primary alias of a tenant, if any.
+func (s *aliasStore) primaryTenantAlias(tenantId string) string {
+	for id, t := range s.Tenants {
+		if strings.EqualFold(id, tenantId) && len(t.Aliases) > 0 {
+			return t.Aliases[0]
+		}
+	}
+	return ""
+}
+
+// lookupTenant returns the tenant ID owning a tenant alias, ignoring case.
+func (s *aliasStore) lookupTenant(alias string) (string, bool) {
+	for id, t := range s.Tenants {
+		for _, a := range t.Aliases {
+			if strings.EqualFold(a, alias) {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// resolveTenant turns a tenant alias or ID into a tenant ID known from the
+// loaded subscriptions or the alias store.
+func resolveTenant(aliases []subscriptionAlias, store *aliasStore, query string) (string, error) {
+	if id, ok := store.lookupTenant(query); ok {
+		return id, nil
+	}
+	for _, s := range aliases {
+		if strings.EqualFold(s.TenantID, query) {
+			return s.TenantID, nil
+		}
+	}
+	for id := range store.Tenants {
+		if strings.EqualFold(id, query) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("tenant '%s' not found", query)
+}
+
+// filterByTenant returns the subscriptions accessed through the tenant.
+// Indexes are kept so that they still select the same subscription.
+func filterByTenant(aliases []subscriptionAlias, tenantId string) []subscriptionAlias {
+	var filtered []subscriptionAlias
+	for _, s := range aliases {
+		if strings.EqualFold(s.TenantID, tenantId) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
+
+// tenantSubscriptions narrows subscriptions down to a tenant alias or ID.
+func (c *config) tenantSubscriptions(aliases []subscriptionAlias, tenant string) ([]subscriptionAlias, error) {
+	store, err := c.loadMergedAliasStore()
+	if err != nil {
+		return nil, err
+	}
+	tenantId, err := resolveTenant(aliases, store, tenant)
+	if err != nil {
+		return nil, err
+	}
+	filtered := filterByTenant(aliases, tenantId)
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no subscriptions found in tenant '%s'", tenant)
+	}
+	return filtered, nil
+}
+
+// groupByTenant splits subscriptions by tenant, keeping the order in which
+// tenants first appear.
+func groupByTenant(aliases []subscriptionAlias) [][]subscriptionAlias {
+	var groups [][]subscriptionAlias
+	index := make(map[string]int)
+	for _, s := range aliases {
+		key := strings.ToLower(s.TenantID)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], s)
+	}
+	return groups
+}
+
+// displayAliasesGrouped prints one table per tenant.
+func displayAliasesGrouped(aliases []subscriptionAlias, columns []string) {
+	tenantFmt := color.New(color.FgCyan, color.Bold).SprintfFunc()
+	for i, group := range groupByTenant(aliases) {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(tenantFmt("Tenant %s, subscriptions: %d", tenantLabel(group[0]), len(group)))
+		displayAliases(group, columns)
+	}
+}
+
+func tenantLabel(s subscriptionAlias) string {
+	switch {
+	case s.TenantID == "":
+		return "(unknown)"
+	case s.TenantAlias != "":
+		return fmt.Sprintf("%s (%s)", s.TenantAlias, s.TenantID)
+	default:
+		return s.TenantID
+	}
+}
+
+// runTenantAliasCommand handles the "alias tenant" subcommand.
+func runTenantAliasCommand(cfg *config, args []string, force bool) error {
+	if len(args) == 0 {
+		return fmt.Errorf(tenantUsage)
+	}
+
+	switch args[0] {
+	case "ls", "list":
+		return listTenantAliases(cfg)
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: az-wrap alias tenant set <tenant> <alias> [-force]")
+		}
+		return cfg.setTenantAlias(args[1], args[2], force)
+	case "rm", "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: az-wrap alias tenant rm <alias|tenant-id>")
+		}
+		return cfg.removeTenantAlias(args[1])
+	default:
+		return fmt.Errorf("unknown tenant command '%s'\n\n%s", args[0], tenantUsage)
+	}
+}
+
+// setTenantAlias sets the primary alias of a tenant in the user store.
+func (c *config) setTenantAlias(query, alias string, force bool) error {
+	user, merged, err := c.loadAliasStores()
+	if err != nil {
+		return err
+	}
+
+	aliases, err := c.subscriptionAliases()
+	if err != nil && !force {
+		return fmt.Errorf("unable to validate tenant alias, use -force to skip validation: %w", err)
+	}
+	tenantId, err := resolveTenant(aliases, merged, query)
+	if err != nil {
+		if !force {
+			return fmt.Errorf("%w, use -force to alias a tenant without subscriptions", err)
+		}
+		tenantId = query
+	}
+	if !force {
+		if strings.TrimSpace(alias) == "" {
+			return fmt.Errorf("the tenant alias is empty")
+		}
+		if owner, ok := merged.lookupTenant(alias); ok && !strings.EqualFold(owner, tenantId) {
+			return fmt.Errorf("tenant alias '%s' is already used by tenant ID '%s', use -force to set it anyway", alias, owner)
+		}
+	}
+
+	t, ok := user.Tenants[tenantId]
+	if !ok {
+		t = &tenantMeta{}
+		if mt, ok := merged.Tenants[tenantId]; ok {
+			t.Aliases = append(t.Aliases, mt.Aliases...)
+		}
+		user.Tenants[tenantId] = t
+	}
+	// An additional alias moves up to replace the primary one. Setting the
+	// primary alias again keeps the others.
+	if i := slices.IndexFunc(t.Aliases, func(a string) bool { return strings.EqualFold(a, alias) }); i > 0 {
+		t.Aliases = slices.Delete(t.Aliases, i, i+1)
+	}
+	if len(t.Aliases) == 0 {
+		t.Aliases = []string{alias}
+	} else {
+		t.Aliases[0] = alias
+	}
+
+	if err := c.saveAliasStore(user); err != nil {
+		return fmt.Errorf("error writing to alias file: %w", err)
+	}
+	fmt.Printf("Alias '%s' set for tenant ID '%s'.\n", alias, tenantId)
+	return nil
+}
+
+// removeTenantAlias removes a tenant alias from the user store, or all
+// aliases of a tenant when key is a tenant ID.
+func (c *config) removeTenantAlias(key string) error {
+	user, err := c.loadAliasStore()
+	if err != nil {
+		return err
+	}
+
+	if t, ok := user.Tenants[key]; ok {
+		fmt.Printf("Alias '%s' removed from tenant ID '%s'.\n", strings.Join(t.Aliases, "', '"), key)
+		delete(user.Tenants, key)
+	} else if id, ok := user.lookupTenant(key); ok {
+		t := user.Tenants[id]
+		var rest []string
+		for _, a := range t.Aliases {
+			if !strings.EqualFold(a, key) {
+				rest = append(rest, a)
+			}
+		}
+		t.Aliases = rest
+		fmt.Printf("Alias '%s' removed from tenant ID '%s'.\n", key, id)
+	} else {
+		return fmt.Errorf("tenant alias or ID '%s' not found in %s", key, c.storeFile)
+	}
+
+	if err := c.saveAliasStore(user); err != nil {
+		return fmt.Errorf("error writing to alias file: %w", err)
+	}
+	return nil
+}
+
+// listTenantAliases prints every tenant of the loaded subscriptions and every
+// aliased tenant.
+func listTenantAliases(cfg *config) error {
+	store, err := cfg.loadMergedAliasStore()
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int)
+	var order []string
+	if aliases, err := cfg.subscriptionAliases(); err == nil {
+		for _, s := range aliases {
+			key := strings.ToLower(s.TenantID)
+			if counts[key] == 0 {
+				order = append(order, s.TenantID)
+			}
+			counts[key]++
+		}
+	}
+	for id := range store.Tenants {
+		if counts[strings.ToLower(id)] == 0 {
+			order = append(order, id)
+		}
+	}
+
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	tbl := table.New("Alias", "Tenant ID", "Subscriptions")
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	for _, id := range order {
+		alias := "(no alias)"
+		if t, ok := store.Tenants[id]; ok && len(t.Aliases) > 0 {
+			alias = strings.Join(t.Aliases, ", ")
+		}
+		tbl.AddRow(alias, id, counts[strings.ToLower(id)])
+	}
+	tbl.Print()
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTenantSelection(t *testing.T) {
+	aliases := []subscriptionAlias{
+		{Index: 1, Name: "shared", ID: testSubA, TenantID: "tenant-a"},
+		{Index: 2, Name: "shared", ID: testSubB, TenantID: "tenant-b"},
+		{Index: 3, Name: "other", ID: testSubC, TenantID: "tenant-a"},
+	}
+	store := newAliasStore()
+	store.Tenants["tenant-b"] = &tenantMeta{Aliases: []string{"customer"}}
+
+	tenantId, err := resolveTenant(aliases, store, "CUSTOMER")
+	if err != nil || tenantId != "tenant-b" {
+		t.Fatalf("Failed to resolve tenant alias. Got: %s, %v", tenantId, err)
+	}
+	if _, err := resolveTenant(aliases, store, "missing"); err == nil {
+		t.Fatalf("Expected error for unknown tenant, got none")
+	}
+
+	filtered := filterByTenant(aliases, tenantId)
+	s, ok := findSubscription(filtered, "shared")
+	if !ok || s.ID != testSubB || s.Index != 2 {
+		t.Fatalf("Expected the tenant filter to pick the second 'shared', got: %+v", s)
+	}
+
+	groups := groupByTenant(aliases)
+	if len(groups) != 2 || len(groups[0]) != 2 || groups[0][1].ID != testSubC {
+		t.Fatalf("Unexpected tenant groups: %+v", groups)
+	}
+}
+
+func TestSetTenantAlias(t *testing.T) {
+	c := testConfig(t, "")
+
+	if err := c.setTenantAlias("tenant-a", "contoso", true); err != nil {
+		t.Fatalf("Failed to set tenant alias: %v", err)
+	}
+	store, _ := c.loadAliasStore()
+	store.Tenants["tenant-a"].Aliases = append(store.Tenants["tenant-a"].Aliases, "cts")
+	if err := c.saveAliasStore(store); err != nil {
+		t.Fatalf("Failed to save alias store: %v", err)
+	}
+
+	if err := c.setTenantAlias("tenant-a", "contoso", true); err != nil {
+		t.Fatalf("Failed to set tenant alias again: %v", err)
+	}
+	store, _ = c.loadAliasStore()
+	if got := strings.Join(store.Tenants["tenant-a"].Aliases, ","); got != "contoso,cts" {
+		t.Fatalf("Expected setting the primary alias again to keep the others, got: %s", got)
+	}
+
+	if err := c.setTenantAlias("tenant-a", "CTS", true); err != nil {
+		t.Fatalf("Failed to set tenant alias: %v", err)
+	}
+	store, _ = c.loadAliasStore()
+	if got := strings.Join(store.Tenants["tenant-a"].Aliases, ","); got != "CTS" {
+		t.Fatalf("Expected the additional alias to replace the primary one, got: %s", got)
+	}
+}
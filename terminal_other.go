@@ -0,0 +1,14 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package main
+
+import "os"
+
+// makeRaw is not supported here, so the table is shown instead of the picker.
+func makeRaw(in, out *os.File) (func(), error) {
+	return nil, errNoTerminal
+}
+
+func terminalSize(out *os.File) (int, int, error) {
+	return 0, 0, errNoTerminal
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+)
+
+// Exit codes of 'az-wrap use', so scripts can tell failures apart. Any other
+// error exits with 1.
+const (
+	exitNotFound  = 3
+	exitAmbiguous = 4
+	exitAzure     = 5
+)
+
+// azureError is a failure to load or switch subscriptions through the Azure
+// CLI or its files.
+type azureError struct {
+	err error
+}
+
+func (e *azureError) Error() string { return e.err.Error() }
+
+func (e *azureError) Unwrap() error { return e.err }
+
+// selectableSubscriptions loads the subscriptions and applies the -tenant,
+// -cloud and -pinned filters.
+func selectableSubscriptions(cfg *config, opts options) ([]subscriptionAlias, error) {
+	aliases, err := cfg.subscriptionAliases()
+	if err != nil {
+		return nil, &azureError{err}
+	}
+	return filterSubscriptions(cfg, aliases, opts)
+}
+
+// filterSubscriptions applies the -tenant, -cloud and -pinned filters.
+func filterSubscriptions(cfg *config, aliases []subscriptionAlias, opts options) ([]subscriptionAlias, error) {
+	var err error
+	if opts.tenant != "" {
+		if aliases, err = cfg.tenantSubscriptions(aliases, opts.tenant); err != nil {
+			return nil, err
+		}
+	}
+	if opts.cloud != "" {
+		if aliases = filterByCloud(aliases, opts.cloud); len(aliases) == 0 {
+			return nil, fmt.Errorf("no subscriptions in cloud '%s'", opts.cloud)
+		}
+	}
+	if opts.pinned {
+		if aliases = filterPinned(aliases); len(aliases) == 0 {
+			return nil, fmt.Errorf("no pinned subscriptions, pin one with 'az-wrap pin <subscription>'")
+		}
+	}
+	return aliases, nil
+}
+
+// runUseCommand switches to the subscription matching the query without
+// asking, see resolveSubscription.
+func runUseCommand(ctx context.Context, cfg *config, opts options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: az-wrap use <index|alias|name|id>")
+	}
+
+	return useSubscription(ctx, cfg, opts, args[0], resolveSubscription)
+}
+
+// runBareQuery switches to the subscription of a bare 'az-wrap <query>'. It
+// only accepts exact and prefix matches, see resolvePrefix.
+func runBareQuery(ctx context.Context, cfg *config, opts options, query string) error {
+	err := useSubscription(ctx, cfg, opts, query, resolvePrefix)
+	var notFound *notFoundError
+	if errors.As(err, &notFound) {
+		return fmt.Errorf("%w, and '%s' is no command. Use 'az-wrap use %s' to match loosely", err, query, query)
+	}
+	return err
+}
+
+// useSubscription switches to the subscription resolve selects for query.
+func useSubscription(ctx context.Context, cfg *config, opts options, query string, resolve func([]subscriptionAlias, string) (subscriptionAlias, error)) error {
+	aliases, err := selectableSubscriptions(cfg, opts)
+	if err != nil {
+		return err
+	}
+	s, err := resolve(aliases, query)
+	if err != nil {
+		return err
+	}
+	if err := cfg.setSubscription(ctx, s.ID, s.Cloud); err != nil {
+		return &azureError{err}
+	}
+	fmt.Printf("Selected %s with ID %s\n", s.Name, s.ID)
+	return nil
+}
+
+// exitUse reports an error of 'use' and exits with its exit code. The
+// candidates of an ambiguous query are listed on stderr.
+func exitUse(err error) {
+	log.Println(err)
+
+	var notFound *notFoundError
+	var ambiguous *ambiguousError
+	var azure *azureError
+	switch {
+	case errors.As(err, &notFound):
+		os.Exit(exitNotFound)
+	case errors.As(err, &ambiguous):
+		headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+		tbl := table.New("Index", "Alias", "Name", "ID").WithWriter(os.Stderr)
+		tbl.WithHeaderFormatter(headerFmt)
+		for _, s := range ambiguous.Matches {
+			tbl.AddRow(s.Index, s.Alias, s.Name, s.ID)
+		}
+		tbl.Print()
+		os.Exit(exitAmbiguous)
+	case errors.As(err, &azure):
+		os.Exit(exitAzure)
+	}
+	os.Exit(1)
+}
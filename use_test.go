@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunUseCommand(t *testing.T) {
+	c := testConfig(t, `{"subscriptions": [
+		{"name": "payments-prod", "id": "`+testSubA+`", "isDefault": true},
+		{"name": "payments-dev", "id": "`+testSubB+`", "isDefault": false}
+	]}`)
+	ctx := context.Background()
+
+	var notFound *notFoundError
+	if err := runUseCommand(ctx, c, options{}, []string{"staging"}); !errors.As(err, &notFound) {
+		t.Errorf("Expected not found error, got: %v", err)
+	}
+	var ambiguous *ambiguousError
+	if err := runUseCommand(ctx, c, options{}, []string{"payments"}); !errors.As(err, &ambiguous) {
+		t.Errorf("Expected ambiguous error, got: %v", err)
+	}
+
+	if err := runUseCommand(ctx, c, options{}, []string{"pay-dev"}); err != nil {
+		t.Fatalf("Failed to use subscription: %v", err)
+	}
+	subs, err := c.getSubscriptionsFromFile()
+	if err != nil || !subs[1].Selected || subs[0].Selected {
+		t.Fatalf("Expected payments-dev to be the default, got: %+v, %v", subs, err)
+	}
+
+	// A bare query only matches exactly or by prefix.
+	if err := runBareQuery(ctx, c, options{}, "pay-prod"); !errors.As(err, &notFound) {
+		t.Errorf("Expected not found error for a loose bare query, got: %v", err)
+	}
+	if err := runBareQuery(ctx, c, options{}, "payments"); !errors.As(err, &ambiguous) {
+		t.Errorf("Expected ambiguous error for a shared prefix, got: %v", err)
+	}
+	if err := runBareQuery(ctx, c, options{}, "payments-p"); err != nil {
+		t.Fatalf("Failed to use subscription by prefix: %v", err)
+	}
+	if subs, err := c.getSubscriptionsFromFile(); err != nil || !subs[0].Selected {
+		t.Fatalf("Expected payments-prod to be the default, got: %+v, %v", subs, err)
+	}
+
+	var azure *azureError
+	c.setAzureDir(t.TempDir())
+	if err := runUseCommand(ctx, c, options{}, []string{"pay-dev"}); !errors.As(err, &azure) {
+		t.Errorf("Expected Azure error without a profile, got: %v", err)
+	}
+}